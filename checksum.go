@@ -0,0 +1,103 @@
+package geofabrik
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// checksumPattern is a line of md5sum output, the filename is separated by
+// two spaces, or by a space and an asterisk in binary mode.
+var checksumPattern = regexp.MustCompile(`^([0-9A-Fa-f]{32}) [ *](\S+)$`)
+
+// Checksum is the md5 Geofabrik publishes next to every pbf.
+type Checksum struct {
+	Hash     string
+	Filename string
+}
+
+// String returns the checksum in md5sum format.
+func (c Checksum) String() string {
+	return c.Hash + "  " + c.Filename
+}
+
+// ParseChecksum parses a single line of md5sum output, e.g.
+// "d41d8cd98f00b204e9800998ecf8427e  berlin-latest.osm.pbf". The hash is
+// returned in lower case.
+func ParseChecksum(s string) (Checksum, error) {
+	line := strings.TrimRight(s, "\r\n")
+	if line == "" {
+		return Checksum{}, InvalidChecksumError{Reason: "empty response"}
+	}
+
+	m := checksumPattern.FindStringSubmatch(line)
+	if m == nil {
+		return Checksum{}, InvalidChecksumError{
+			Content: snippet(strings.NewReader(line)),
+			Reason:  "not in md5sum format",
+		}
+	}
+
+	return Checksum{Hash: strings.ToLower(m[1]), Filename: m[2]}, nil
+}
+
+// Checksum returns the latest checksum of a dataset. It fails with an
+// InvalidChecksumError unless the response is in the format of the Provider
+// and names the pbf of the dataset.
+func (g *Geofabrik) Checksum(ctx context.Context, name string) (Checksum, error) {
+	p, err := g.resolve(ctx, name, FileTypeMD5)
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	return g.checksum(ctx, p)
+}
+
+func (g *Geofabrik) checksum(ctx context.Context, p *Path) (Checksum, error) {
+	res, err := g.request(ctx, g.authoritative(), "GET", p.uri, accept(p.ftype))
+	if err != nil {
+		return Checksum{}, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return Checksum{}, DownloadFailedError{Message: err.Error(), URL: p.URL(), Err: err}
+	}
+
+	expected, err := p.checksummed()
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	c, err := p.provider.ParseChecksum(string(body), expected)
+	if err != nil {
+		var invalid InvalidChecksumError
+		if errors.As(err, &invalid) {
+			invalid.URL = p.URL()
+			return Checksum{}, invalid
+		}
+		return Checksum{}, err
+	}
+
+	return c, nil
+}
+
+// verify compares the md5 got of the download of p to want.
+func (g *Geofabrik) verify(ctx context.Context, p *Path, want, got string) (err error) {
+	_, span := g.startSpan(ctx, SpanVerify)
+	span.SetAttribute("region", p.name)
+	span.SetAttribute("md5", got)
+	defer func() { endSpan(span, err) }()
+
+	if got != want {
+		g.logger().Warn("checksum mismatch", "name", p.name, "expected", want, "got", got)
+		g.meter().Add(MetricChecksumMismatches, nil, 1)
+		return ChecksumMismatchError{Expected: want, Got: got}
+	}
+
+	g.logger().Debug("checksum verified", "name", p.name, "md5", got)
+	return nil
+}
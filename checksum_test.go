@@ -0,0 +1,71 @@
+package geofabrik
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChecksum(t *testing.T) {
+	type tcase struct {
+		input    string
+		expected Checksum
+		invalid  bool
+	}
+
+	tests := map[string]tcase{
+		"text mode": {
+			input:    fooMD5 + "  berlin-latest.osm.pbf\n",
+			expected: Checksum{Hash: fooMD5, Filename: "berlin-latest.osm.pbf"},
+		},
+		"binary mode": {
+			input:    fooMD5 + " *berlin-latest.osm.pbf",
+			expected: Checksum{Hash: fooMD5, Filename: "berlin-latest.osm.pbf"},
+		},
+		"upper case": {
+			input:    strings.ToUpper(fooMD5) + "  berlin-latest.osm.pbf\r\n",
+			expected: Checksum{Hash: fooMD5, Filename: "berlin-latest.osm.pbf"},
+		},
+		"empty": {
+			input:   "",
+			invalid: true,
+		},
+		"html": {
+			input:   "<html><body>please log in</body></html>",
+			invalid: true,
+		},
+		"hash only": {
+			input:   fooMD5,
+			invalid: true,
+		},
+		"short hash": {
+			input:   "acbd18db  berlin-latest.osm.pbf",
+			invalid: true,
+		},
+		"not hex": {
+			input:   "z" + fooMD5[1:] + "  berlin-latest.osm.pbf",
+			invalid: true,
+		},
+		"several lines": {
+			input:   fooMD5 + "  berlin-latest.osm.pbf\n" + fooMD5 + "  berlin.poly\n",
+			invalid: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseChecksum(tc.input)
+			if tc.invalid {
+				var invalid InvalidChecksumError
+				assert.ErrorAs(t, err, &invalid)
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to parse checksum", err)
+			}
+			assert.Equal(t, tc.expected, got)
+			assert.Equal(t, fooMD5+"  berlin-latest.osm.pbf", got.String())
+		})
+	}
+}
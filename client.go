@@ -4,127 +4,260 @@ package geofabrik
 import (
 	"bufio"
 	"context"
+	"crypto/md5" //nolint: gosec
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/iwpnd/rip"
 )
 
+// FileType is the suffix of a file published for every dataset.
 type FileType string
 
 const (
-	md5type  FileType = ".osm.pbf.md5"
-	pbftype  FileType = ".osm.pbf"
-	polytype FileType = ".poly"
+	FileTypeMD5  FileType = ".osm.pbf.md5"
+	FileTypePBF  FileType = ".osm.pbf"
+	FileTypePoly FileType = ".poly"
 )
 
+// DefaultHost is the Geofabrik download server.
+const DefaultHost = "http://download.geofabrik.de"
+
+// maxSnippet is how much of an error response is kept in an error.
+const maxSnippet = 256
+
+// accept returns the Accept header to request a file of type ftype with.
+func accept(ftype FileType) string {
+	switch ftype { //nolint: exhaustive
+	case FileTypePBF:
+		return "application/octet-stream"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
 // Geofabrik wraps a rest client.
 type Geofabrik struct {
+	// Client is nil unless the Geofabrik was created with New.
 	*rip.Client
+	host        *url.URL
+	header      http.Header
+	dial        func(rawURL string) (*upstream, error)
+	hosts       []*upstream
+	health      *health
+	resolver    *Resolver
+	spaceMargin int64
+	segments    int
+	limiter     *RateLimiter
+	gates       *gates
+	provider    Provider
+	log         *slog.Logger
+	metrics     Metrics
+	tracer      Tracer
+	lockWait    time.Duration
 }
 
-// New is the constructor for a Geofabrik.
+// Downloader is what a Geofabrik offers. Depend on it instead of *Geofabrik
+// to substitute the client in tests, see the geofabriktest package for a
+// fake server to run a real one against.
+type Downloader interface {
+	URL(name string, ftype FileType) (string, error)
+	MD5(ctx context.Context, name string) (string, error)
+	Checksum(ctx context.Context, name string) (Checksum, error)
+	Polygon(ctx context.Context, name string) (*Polygon, error)
+	Size(ctx context.Context, name string) (int64, error)
+	Stat(ctx context.Context, name string, ftype FileType) (FileInfo, error)
+	Download(ctx context.Context, name, outpath string) error
+	DownloadWithResult(ctx context.Context, name, outpath string) (DownloadResult, error)
+	Index(ctx context.Context) (*Index, error)
+	CachedIndex(ctx context.Context, path string, maxAge time.Duration) (*Index, error)
+	Plan(ctx context.Context, m *Manifest, dir string, opts SyncOptions) (*SyncPlan, error)
+	Sync(ctx context.Context, m *Manifest, dir string, opts SyncOptions) (*SyncPlan, error)
+	Watch(ctx context.Context, names []string, opts WatchOptions) error
+}
+
+var _ Downloader = (*Geofabrik)(nil)
+
+// New is the constructor for a Geofabrik. It sends requests with rip, see
+// NewClient to use a standard http client instead.
 func New(host string, options ...rip.Option) (*Geofabrik, error) {
-	c, err := rip.NewClient(host, options...)
+	dial := func(rawURL string) (*upstream, error) {
+		return newRipUpstream(rawURL, options...)
+	}
+
+	h, err := dial(host)
 	if err != nil {
 		return &Geofabrik{}, err
 	}
+	c := h.client.(ripDoer).client //nolint: forcetypeassert
 
+	return newGeofabrik(h, c, c.NR().Header, dial), nil
+}
+
+// newGeofabrik returns a Geofabrik for the host h. header is sent with every
+// request, dial creates the upstreams of mirrors.
+func newGeofabrik(h *upstream, c *rip.Client, header http.Header, dial func(string) (*upstream, error)) *Geofabrik {
 	return &Geofabrik{
-		Client: c,
-	}, nil
+		Client:      c,
+		host:        h.url,
+		header:      header,
+		dial:        dial,
+		hosts:       []*upstream{h},
+		health:      newHealth(DefaultCoolDown),
+		spaceMargin: DefaultSpaceMargin,
+		lockWait:    DefaultLockWait,
+		gates:       newGates(DefaultRequestLimits),
+		provider:    DefaultProvider,
+	}
 }
 
-// MD5 will return the latest MD5 of a dataset
-func (g *Geofabrik) MD5(ctx context.Context, name string) (string, error) {
-	p, err := newPath(name, md5type)
+// URL returns the absolute url of the file of type ftype of a dataset.
+func (g *Geofabrik) URL(name string, ftype FileType) (string, error) {
+	p, err := g.path(name, ftype)
 	if err != nil {
 		return "", err
 	}
 
-	req := g.NR().SetHeader(
-		"Accept",
-		"text/plain; charset=utf-8",
-	)
-	res, err := req.Execute(
-		ctx,
-		"GET",
-		p.uri,
-	)
+	return p.URL(), nil
+}
+
+// request executes a request for uri on h. Network errors and error responses
+// are returned as DownloadFailedError. Unless an error is returned, the
+// caller has to close the body of the response.
+func (g *Geofabrik) request(ctx context.Context, h *upstream, method, uri, accept string) (*http.Response, error) {
+	return g.do(ctx, h, method, uri, map[string]string{"Accept": accept})
+}
+
+// do is request with arbitrary headers. It waits for the RequestLimits of
+// the host, the connection is accounted for until the body is closed.
+func (g *Geofabrik) do(ctx context.Context, h *upstream, method, uri string, header map[string]string) (*http.Response, error) {
+	release, err := g.gates.acquire(ctx, h.url.Host)
 	if err != nil {
-		return "", errors.Join(err, DownloadFailedError{
+		return nil, DownloadFailedError{
 			Message: err.Error(),
-			Code:    res.StatusCode(),
-			URL:     res.Request.URL,
-		})
+			URL:     h.urlOf(uri),
+			Err:     err,
+		}
 	}
 
-	if res.StatusCode() >= 400 {
-		return "", errors.Join(err, DownloadFailedError{
-			Code: res.StatusCode(),
-			URL:  res.Request.URL,
-		})
+	// the request carries the span, a tracer may propagate it
+	ctx, span := g.startSpan(ctx, SpanRequest)
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("url", h.urlOf(uri))
+
+	req, err := http.NewRequestWithContext(ctx, method, h.urlOf(uri), http.NoBody)
+	if err != nil {
+		release()
+		endSpan(span, err)
+		return nil, DownloadFailedError{
+			Message: err.Error(),
+			URL:     h.urlOf(uri),
+			Err:     err,
+		}
 	}
-	defer func() {
-		if cErr := res.Close(); cErr != nil {
-			if err == nil {
-				err = cErr
-			} else {
-				err = errors.Join(err, cErr)
-			}
+	for k, v := range g.header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", DefaultUserAgent)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	log := g.logger().With("method", method, "url", h.urlOf(uri))
+	log.Debug("request started")
+	started := time.Now()
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		release()
+		g.observeRequest(h.url.Host, method, 0, started)
+		span.SetAttribute("http.status_code", 0)
+		endSpan(span, err)
+		log.Debug("request failed", "error", err, "duration", time.Since(started))
+		return nil, DownloadFailedError{
+			Message: err.Error(),
+			URL:     h.urlOf(uri),
+			Err:     err,
 		}
-	}()
+	}
 
-	md5 := strings.Split(res.String(), "  ")[0]
+	g.observeRequest(h.url.Host, method, res.StatusCode, started)
+	span.SetAttribute("http.status_code", res.StatusCode)
+	if res.StatusCode >= http.StatusBadRequest {
+		span.RecordError(errors.New(res.Status))
+	}
+	span.End()
+	log.Debug("request finished", "status", res.StatusCode, "duration", time.Since(started))
+
+	res.Body = &releaseBody{ReadCloser: res.Body, release: sync.OnceFunc(release)}
+
+	// a 304 only follows a conditional request, there is nothing to read
+	if res.StatusCode >= http.StatusBadRequest || res.StatusCode == http.StatusNotModified {
+		defer res.Body.Close()
+		return res, DownloadFailedError{
+			Message: snippet(res.Body),
+			Code:    res.StatusCode,
+			URL:     h.urlOf(uri),
+		}
+	}
 
-	return md5, nil
+	return res, nil
 }
 
-func (g *Geofabrik) Polygon(ctx context.Context, name string) (*Polygon, error) {
-	p, err := newPath(name, polytype)
+// snippet returns the start of an error response to include in errors.
+func snippet(body io.Reader) string {
+	if body == nil {
+		return ""
+	}
+
+	b, err := io.ReadAll(io.LimitReader(body, maxSnippet))
 	if err != nil {
-		return &Polygon{}, err
+		return ""
 	}
 
-	req := g.NR().SetHeader(
-		"Accept",
-		"text/plain; charset=utf-8",
-	)
-	res, err := req.Execute(
-		ctx,
-		"GET",
-		p.uri,
-	)
+	return strings.Join(strings.Fields(string(b)), " ")
+}
+
+// MD5 will return the latest MD5 of a dataset
+func (g *Geofabrik) MD5(ctx context.Context, name string) (string, error) {
+	c, err := g.Checksum(ctx, name)
 	if err != nil {
-		return &Polygon{}, errors.Join(err, DownloadFailedError{
-			Message: err.Error(),
-			Code:    res.StatusCode(),
-			URL:     res.Request.URL,
-		})
+		return "", err
 	}
 
-	if res.StatusCode() >= 400 {
-		return &Polygon{}, DownloadFailedError{
-			Code: res.StatusCode(),
-			URL:  res.Request.URL,
-		}
+	return c.Hash, nil
+}
+
+func (g *Geofabrik) Polygon(ctx context.Context, name string) (*Polygon, error) {
+	p, err := g.resolve(ctx, name, FileTypePoly)
+	if err != nil {
+		return &Polygon{}, err
 	}
-	defer func() {
-		if cErr := res.Close(); cErr != nil {
-			if err == nil {
-				err = cErr
-			} else {
-				err = errors.Join(err, cErr)
-			}
+
+	var polygon *Polygon
+	err = g.failover(ctx, func(h *upstream) error {
+		res, err := g.request(ctx, h, "GET", p.uri, accept(p.ftype))
+		if err != nil {
+			return err
 		}
-	}()
+		defer res.Body.Close()
 
-	polygon := NewPolygon(name, res.RawBody())
-	err = polygon.Process()
+		polygon = NewPolygon(name, res.Body)
+		return polygon.Process()
+	})
 	if err != nil {
 		return &Polygon{}, err
 	}
@@ -132,83 +265,255 @@ func (g *Geofabrik) Polygon(ctx context.Context, name string) (*Polygon, error)
 	return polygon, nil
 }
 
-// Download a dataset to output path
-func (g *Geofabrik) Download(ctx context.Context, name, outpath string) error {
-	p, err := newPath(name, pbftype)
+// Size returns the size in bytes of the latest pbf of a dataset without
+// downloading it.
+func (g *Geofabrik) Size(ctx context.Context, name string) (int64, error) {
+	info, err := g.Stat(ctx, name, FileTypePBF)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size, nil
+}
+
+// FileInfo describes a file on the server.
+type FileInfo struct {
+	Name         string    `json:"name"`
+	URL          string    `json:"url"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag"`
+	AcceptRanges bool      `json:"accept_ranges"`
+}
+
+// Stat describes the file of type ftype of a dataset without downloading
+// it. Fields the server does not send are left zero, Size is -1 then.
+func (g *Geofabrik) Stat(ctx context.Context, name string, ftype FileType) (FileInfo, error) {
+	p, err := g.resolve(ctx, name, ftype)
 	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return g.stat(ctx, p)
+}
+
+func (g *Geofabrik) stat(ctx context.Context, p *Path) (FileInfo, error) {
+	var info FileInfo
+	err := g.failover(ctx, func(h *upstream) error {
+		var err error
+		info, err = g.statOn(ctx, h, p)
 		return err
+	})
+
+	return info, err
+}
+
+// statOn describes the file p points to on h.
+func (g *Geofabrik) statOn(ctx context.Context, h *upstream, p *Path) (FileInfo, error) {
+	res, err := g.request(ctx, h, "HEAD", p.uri, accept(p.ftype))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer res.Body.Close()
+
+	header := res.Header
+	info := FileInfo{
+		Name:         p.name,
+		URL:          h.urlOf(p.uri),
+		Size:         res.ContentLength,
+		ETag:         header.Get("ETag"),
+		AcceptRanges: strings.EqualFold(header.Get("Accept-Ranges"), "bytes"),
+	}
+	if lm := header.Get("Last-Modified"); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			info.LastModified = t
+		}
 	}
 
-	fp := fmt.Sprintf(
-		"%s/%s",
-		outpath,
-		p.filename,
-	)
+	return info, nil
+}
 
-	req := g.NR().SetHeader(
-		"Accept",
-		"application/octet-stream",
-	)
-	res, err := req.Execute(
-		ctx,
-		"GET",
-		p.uri,
+// Download a dataset to output path. name may also be a link to a file on
+// the configured host, e.g. https://download.geofabrik.de/europe/germany/berlin-latest.osm.pbf
+func (g *Geofabrik) Download(ctx context.Context, name, outpath string) error {
+	_, err := g.DownloadWithResult(ctx, name, outpath)
+	return err
+}
+
+// DownloadWithResult downloads a dataset to output path and describes
+// the finished download.
+func (g *Geofabrik) DownloadWithResult(ctx context.Context, name, outpath string) (DownloadResult, error) {
+	p, err := g.resolve(ctx, name, g.inferType(name, FileTypePBF))
+	if err != nil {
+		return DownloadResult{}, err
+	}
+
+	fp, err := p.target(outpath)
+	if err != nil {
+		return DownloadResult{}, err
+	}
+
+	return g.download(ctx, p, fp)
+}
+
+// DownloadResult describes a finished download. In json the duration is in
+// seconds, like everywhere else the cli prints json.
+type DownloadResult struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	MD5      string        `json:"md5"`
+	Bytes    int64         `json:"bytes"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"-"`
+}
+
+func (r DownloadResult) MarshalJSON() ([]byte, error) {
+	type plain DownloadResult
+	return json.Marshal(struct {
+		plain
+		Duration float64 `json:"duration"`
+	}{plain(r), r.Duration.Seconds()})
+}
+
+// download fetches the file p points to and writes it to dest and reports
+// the outcome.
+func (g *Geofabrik) download(ctx context.Context, p *Path, dest string) (DownloadResult, error) {
+	ctx, span := g.startSpan(ctx, SpanDownload)
+	span.SetAttribute("region", p.name)
+	span.SetAttribute("file_type", string(p.ftype))
+
+	result, err := g.fetch(ctx, p, dest)
+	span.SetAttribute("bytes", result.Bytes)
+	endSpan(span, err)
+	g.observeDownload(result, err)
+	if err != nil {
+		g.logger().Error("download failed", "name", p.name, "url", p.url, "error", err)
+		return result, err
+	}
+
+	g.logger().Info(
+		"download finished",
+		"name", p.name,
+		"path", result.Path,
+		"bytes", result.Bytes,
+		"md5", result.MD5,
+		"duration", result.Duration,
 	)
+
+	return result, nil
+}
+
+// fetch fetches the file p points to and writes it to dest, failing over
+// to the next host if needed. No one else writes dest meanwhile.
+func (g *Geofabrik) fetch(ctx context.Context, p *Path, dest string) (DownloadResult, error) {
+	unlock, err := g.lock(ctx, dest)
 	if err != nil {
-		return errors.Join(err, DownloadFailedError{
-			Message: err.Error(),
-			Code:    res.StatusCode(),
-			URL:     res.Request.URL,
-		})
+		return DownloadResult{}, err
 	}
-	defer func() {
-		if cErr := res.Close(); cErr != nil {
-			if err == nil {
-				err = cErr
-			} else {
-				err = errors.Join(err, cErr)
-			}
-		}
-	}()
+	defer unlock()
 
-	if res.IsError() {
-		return DownloadFailedError{
-			Code: res.StatusCode(),
-			URL:  res.Request.URL,
+	// payload from a mirror is verified, so is a segmented download
+	want := ""
+	if p.ftype == FileTypePBF && (g.mirrored() || g.segments > 1) {
+		c, err := p.checksum()
+		if err != nil {
+			return DownloadResult{}, err
+		}
+		sum, err := g.checksum(ctx, c)
+		if err != nil {
+			return DownloadResult{}, err
 		}
+		want = sum.Hash
 	}
 
-	err = g.writeOrRemove(ctx, fp, func(w io.Writer) error {
-		_, err := io.Copy(w, res.RawBody())
+	var result DownloadResult
+	err = g.failover(ctx, func(h *upstream) error {
+		var err error
+		result, err = g.downloadFrom(ctx, h, p, dest, want)
 		return err
 	})
 	if err != nil {
-		return errors.Join(err, CopyFailedError{
-			Message: err.Error(),
-		})
+		return result, err
 	}
 
-	return nil
+	// without the marker the file is merely not pruned or synced away
+	if err := markOwned(dest, result.MD5); err != nil {
+		g.logger().Warn("could not mark download", "path", dest, "error", err)
+	}
+
+	return result, nil
 }
 
-func (g *Geofabrik) writeOrRemove(ctx context.Context, dest string, write func(w io.Writer) error) (err error) {
-	tDir := tmpDir(dest)
-	if _, statErr := os.Stat(tDir); os.IsNotExist(statErr) {
-		if mkErr := os.MkdirAll(tDir, 0o750); mkErr != nil {
-			return fmt.Errorf("creating temporary directory %q: %w", tDir, mkErr)
+// downloadFrom fetches the file p points to from h. Unless want is empty,
+// the file is only moved to dest if its md5 matches.
+func (g *Geofabrik) downloadFrom(ctx context.Context, h *upstream, p *Path, dest, want string) (DownloadResult, error) {
+	result := DownloadResult{
+		Name:    p.name,
+		Path:    dest,
+		Started: time.Now(),
+	}
+
+	if g.segments > 1 && want != "" {
+		result, err := g.downloadSegmented(ctx, h, p, dest, want)
+		if !errors.Is(err, errRangesUnsupported) {
+			return result, err
+		}
+		g.logger().Info("ranges not supported, downloading at once", "host", h.url.Host, "name", p.name)
+	}
+
+	res, err := g.request(ctx, h, "GET", p.uri, accept(p.ftype))
+	if err != nil {
+		return DownloadResult{}, err
+	}
+	defer res.Body.Close()
+
+	if err := g.checkSpace(filepath.Dir(dest), res.ContentLength); err != nil {
+		return DownloadResult{}, err
+	}
+
+	md := md5.New() //nolint: gosec
+	err = g.writeOrRemove(ctx, dest, func(w io.Writer) error {
+		_, span := g.startSpan(ctx, SpanCopy)
+		n, err := io.Copy(io.MultiWriter(w, md), g.limit(ctx, res.Body))
+		span.SetAttribute("bytes", n)
+		endSpan(span, err)
+		result.Bytes = n
+		if err != nil {
+			return err
+		}
+
+		result.MD5 = hex.EncodeToString(md.Sum(nil))
+		if want != "" {
+			return g.verify(ctx, p, want, result.MD5)
+		}
+		return nil
+	})
+	if err != nil {
+		return DownloadResult{}, CopyFailedError{
+			Message: err.Error(),
+			Err:     err,
 		}
 	}
 
-	f, err := os.CreateTemp(tDir, "tmp-")
+	result.Duration = time.Since(result.Started)
+
+	return result, nil
+}
+
+func (g *Geofabrik) writeOrRemove(ctx context.Context, dest string, write func(w io.Writer) error) (err error) {
+	tDir := tmpDir(filepath.Dir(dest))
+	f, created, err := createTemp(tDir)
 	if err != nil {
-		return fmt.Errorf("creating temporary file: %w", err)
+		return err
 	}
 
 	defer func() {
 		if err != nil {
-			_ = f.Close()
-			_ = os.Remove(f.Name())
-			_ = os.RemoveAll(tDir)
+			g.removeTemp(f, err)
+			if created {
+				// only if it is still empty, others may write to it by now
+				_ = os.Remove(tDir)
+			}
 		}
 	}()
 
@@ -245,22 +550,16 @@ func (g *Geofabrik) writeOrRemove(ctx context.Context, dest string, write func(w
 
 	select {
 	case <-ctx.Done():
-		// user cancelled: clean up
+		// user cancelled, the temporary file is removed on return
 		pw.CloseWithError(ctx.Err())
-		f.Close()
-		os.Remove(f.Name())
 		return ctx.Err()
 	case err := <-done:
 		if err != nil {
 			// writer goroutine failed early
-			f.Close()
-			os.Remove(f.Name())
 			return err
 		}
 		// writer finished; wait for the final copy into f
 		if err := <-copyErrCh; err != nil {
-			f.Close()
-			os.Remove(f.Name())
 			return err
 		}
 	}
@@ -272,13 +571,44 @@ func (g *Geofabrik) writeOrRemove(ctx context.Context, dest string, write func(w
 	if err := f.Close(); err != nil {
 		return fmt.Errorf("while closing temporary file: %w", err)
 	}
-	return os.Rename(f.Name(), dest)
+	return g.rename(ctx, f.Name(), dest)
+}
+
+// createTemp creates a temporary file in tDir, creating tDir if needed.
+// created reports whether tDir was created.
+func createTemp(tDir string) (f *os.File, created bool, err error) {
+	if _, statErr := os.Stat(tDir); os.IsNotExist(statErr) {
+		if mkErr := os.MkdirAll(tDir, 0o750); mkErr != nil {
+			return nil, false, fmt.Errorf("creating temporary directory %q: %w", tDir, mkErr)
+		}
+		created = true
+	}
+
+	f, err = os.CreateTemp(tDir, "tmp-")
+	if err != nil {
+		return nil, created, fmt.Errorf("creating temporary file: %w", err)
+	}
+
+	return f, created, nil
+}
+
+// removeTemp removes the temporary file f left by a failed download.
+func (g *Geofabrik) removeTemp(f *os.File, cause error) {
+	_ = f.Close()
+	if err := os.Remove(f.Name()); err != nil && !os.IsNotExist(err) {
+		g.logger().Warn("could not remove temporary file", "path", f.Name(), "error", err)
+		return
+	}
+
+	g.logger().Debug("removed temporary file", "path", f.Name(), "cause", cause)
 }
 
-func tmpDir(dest string) string {
+// tmpDir returns the directory downloads to dir are written to until they
+// are complete.
+func tmpDir(dir string) string {
 	tmpDir := os.Getenv("GEOFABRIK_TMPDIR")
 	if tmpDir == "" {
-		tmpDir = filepath.Dir(dest)
+		tmpDir = dir
 	}
 
 	return tmpDir
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -20,6 +22,9 @@ import (
 
 var ts *httptest.Server
 
+// fooMD5 is the upstream md5 of the dataset foo.
+var fooMD5 = md5Hex(randomDataOfSize(1028 * 128))
+
 func fileExists(dir, filename string) bool {
 	info, err := os.Stat(fmt.Sprintf("%s/%s", dir, filename))
 	if os.IsNotExist(err) {
@@ -32,6 +37,11 @@ func randomDataOfSize(size int) []byte {
 	return []byte(strings.Repeat("#", size))
 }
 
+func md5Hex(b []byte) string {
+	sum := md5.Sum(b) //nolint: gosec
+	return hex.EncodeToString(sum[:])
+}
+
 func compareHash(t *testing.T, expected, got []byte) bool {
 	t.Helper()
 	expectedHash := md5.Sum(expected)
@@ -47,7 +57,7 @@ func compareHash(t *testing.T, expected, got []byte) bool {
 func setupTestServer(responseData []byte) func() {
 	ts = httptest.NewServer(http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == http.MethodGet {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
 				switch r.URL.Path {
 				case "/foo-latest.osm.pbf.md5":
 					accept := r.Header.Get("Accept")
@@ -55,11 +65,20 @@ func setupTestServer(responseData []byte) func() {
 					case "text/plain; charset=utf-8":
 						w.WriteHeader(http.StatusOK)
 						w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-						fmt.Fprint(w, "bar  foo")
+						fmt.Fprint(w, fooMD5+"  foo-latest.osm.pbf\n")
 					default:
 						w.WriteHeader(http.StatusNotAcceptable)
 						fmt.Fprint(w, "nope")
 					}
+				case "/html-latest.osm.pbf.md5":
+					w.Header().Set("Content-Type", "text/html")
+					w.WriteHeader(http.StatusOK)
+					fmt.Fprint(w, "<html><body>please log in</body></html>")
+				case "/empty-latest.osm.pbf.md5":
+					w.WriteHeader(http.StatusOK)
+				case "/other-latest.osm.pbf.md5":
+					w.WriteHeader(http.StatusOK)
+					fmt.Fprint(w, fooMD5+"  foo-latest.osm.pbf\n")
 				case "/foo.poly":
 					accept := r.Header.Get("Accept")
 					switch accept {
@@ -75,6 +94,14 @@ func setupTestServer(responseData []byte) func() {
 					accept := r.Header.Get("Accept")
 					switch accept {
 					case "application/octet-stream":
+						size := 1028 * 128
+						if responseData != nil {
+							size = len(responseData)
+						}
+						w.Header().Set("Content-Length", strconv.Itoa(size))
+						w.Header().Set("Last-Modified", "Sun, 19 Oct 2025 20:21:22 GMT")
+						w.Header().Set("ETag", `"abc-123"`)
+						w.Header().Set("Accept-Ranges", "bytes")
 						w.WriteHeader(http.StatusOK)
 						w.Header().Set("Content-Type", "application/octet-stream")
 						if responseData != nil {
@@ -98,6 +125,15 @@ func setupTestServer(responseData []byte) func() {
 						w.WriteHeader(http.StatusNotAcceptable)
 						fmt.Fprint(w, "nope")
 					}
+				case "/index-v1-nogeom.json":
+					b, err := os.ReadFile("testdata/index-v1-nogeom.json")
+					if err != nil {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					_, _ = w.Write(b)
 				default:
 					w.WriteHeader(http.StatusNotFound)
 				}
@@ -186,7 +222,7 @@ func TestGetMD5(t *testing.T) {
 	tests := map[string]tcase{
 		"should resolve md5": {
 			name:     "foo",
-			expected: "bar",
+			expected: fooMD5,
 		},
 		"should fail to resolve md5": {
 			name:     "test",
@@ -199,6 +235,103 @@ func TestGetMD5(t *testing.T) {
 	}
 }
 
+func TestChecksum(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	ctx := t.Context()
+
+	got, err := g.Checksum(ctx, "foo")
+	if err != nil {
+		t.Fatal("failed to get checksum", err)
+	}
+	assert.Equal(t, Checksum{Hash: fooMD5, Filename: "foo-latest.osm.pbf"}, got)
+
+	for _, name := range []string{"html", "empty", "other"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := g.Checksum(ctx, name)
+			var invalid InvalidChecksumError
+			if assert.ErrorAs(t, err, &invalid) {
+				assert.Equal(t, ts.URL+"/"+name+"-latest.osm.pbf.md5", invalid.URL)
+			}
+
+			md5, err := g.MD5(ctx, name)
+			assert.ErrorAs(t, err, &invalid)
+			assert.Empty(t, md5)
+		})
+	}
+}
+
+func TestSize(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	got, err := g.Size(t.Context(), "foo")
+	if err != nil {
+		t.Fatal("failed to get size", err)
+	}
+	assert.Equal(t, int64(1028*128), got)
+}
+
+func TestStat(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	ctx := t.Context()
+
+	got, err := g.Stat(ctx, "foo", FileTypePBF)
+	if err != nil {
+		t.Fatal("failed to stat", err)
+	}
+	assert.Equal(t, FileInfo{
+		Name:         "foo",
+		URL:          ts.URL + "/foo-latest.osm.pbf",
+		Size:         1028 * 128,
+		LastModified: time.Date(2025, 10, 19, 20, 21, 22, 0, time.UTC),
+		ETag:         `"abc-123"`,
+		AcceptRanges: true,
+	}, got)
+
+	got, err = g.Stat(ctx, "foo", FileTypePoly)
+	if err != nil {
+		t.Fatal("failed to stat", err)
+	}
+	assert.Equal(t, ts.URL+"/foo.poly", got.URL)
+	assert.False(t, got.AcceptRanges)
+	assert.True(t, got.LastModified.IsZero())
+
+	_, err = g.Stat(ctx, "bar", FileTypePBF)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestURL(t *testing.T) {
+	g, err := New("https://download.geofabrik.de")
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	got, err := g.URL("europe/germany/berlin", FileTypePBF)
+	if err != nil {
+		t.Fatal("failed to build url", err)
+	}
+	assert.Equal(t, "https://download.geofabrik.de/europe/germany/berlin-latest.osm.pbf", got)
+}
+
 func TestDownloadCancel(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/europe/germany-latest.osm.pbf" {
@@ -260,6 +393,37 @@ func TestDownload(t *testing.T) {
 	assert.True(t, compareHash(t, responseFile, got))
 }
 
+func TestDownloadURL(t *testing.T) {
+	dir := t.TempDir()
+
+	responseFile := randomDataOfSize(1024 * 128)
+	teardown := setupTestServer(responseFile)
+	defer teardown()
+
+	ctx := t.Context()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	err = g.Download(ctx, ts.URL+"/foo-latest.osm.pbf", dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.True(t, fileExists(dir, "foo.osm.pbf"))
+
+	err = g.Download(ctx, ts.URL+"/foo.poly", dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	assert.True(t, fileExists(dir, "foo.poly"))
+
+	err = g.Download(ctx, "https://download.geofabrik.de/foo-latest.osm.pbf", dir)
+	var mismatch HostMismatchError
+	assert.ErrorAs(t, err, &mismatch)
+}
+
 func TestDownloadFailed(t *testing.T) {
 	teardown := setupTestServer(nil)
 	defer teardown()
@@ -286,6 +450,27 @@ func TestDownloadFailed(t *testing.T) {
 	}
 }
 
+func TestNotFound(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	ctx := t.Context()
+
+	_, err = g.MD5(ctx, "bar")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = g.Polygon(ctx, "bar")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = g.Download(ctx, "bar", t.TempDir())
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NotErrorIs(t, err, ErrServerError)
+}
+
 func TestWriteOrRemove(t *testing.T) {
 	g, err := New(ts.URL)
 	if err != nil {
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	geofabrik "github.com/iwpnd/go-geofabrik"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+var clientFlags []cli.Flag
+
+// clientConfig is the content of the file passed with --config-file. Flags
+// and environment variables take precedence over it.
+type clientConfig struct {
+	Provider       string        `yaml:"provider"`
+	Host           string        `yaml:"host"`
+	Mirrors        []string      `yaml:"mirrors"`
+	CoolDown       time.Duration `yaml:"cool-down"`
+	Timeout        time.Duration `yaml:"timeout"`
+	ConnectTimeout time.Duration `yaml:"connect-timeout"`
+	Proxy          string        `yaml:"proxy"`
+	CABundle       string        `yaml:"ca-bundle"`
+	UserAgent      string        `yaml:"user-agent"`
+	SpaceMargin    string        `yaml:"space-margin"`
+	Segments       int           `yaml:"segments"`
+	RequestRate    float64       `yaml:"request-rate"`
+	MaxConnections int           `yaml:"max-connections"`
+	LockWait       time.Duration `yaml:"lock-wait"`
+	FailIfLocked   bool          `yaml:"fail-if-locked"`
+}
+
+func loadClientConfig(path string) (clientConfig, error) {
+	c := clientConfig{}
+	if path == "" {
+		return c, nil
+	}
+
+	b, err := os.ReadFile(path) //nolint: gosec
+	if err != nil {
+		return c, fmt.Errorf("reading config file %q: %w", path, err)
+	}
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("parsing config file %q: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// setupClient is the Before hook of the app, it creates the geofabrik client
+// from the global flags.
+func setupClient(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	if err := setupLogger(cmd); err != nil {
+		return ctx, err
+	}
+
+	c, err := loadClientConfig(cmd.String("config-file"))
+	if err != nil {
+		return ctx, err
+	}
+
+	str := func(name, fromFile string) string {
+		if cmd.IsSet(name) || fromFile == "" {
+			return cmd.String(name)
+		}
+		return fromFile
+	}
+	dur := func(name string, fromFile time.Duration) time.Duration {
+		if cmd.IsSet(name) || fromFile == 0 {
+			return cmd.Duration(name)
+		}
+		return fromFile
+	}
+
+	transport, err := newTransport(
+		dur("connect-timeout", c.ConnectTimeout),
+		str("proxy", c.Proxy),
+		str("ca-bundle", c.CABundle),
+	)
+	if err != nil {
+		return ctx, err
+	}
+	options := []geofabrik.Option{
+		geofabrik.WithTransport(transport),
+		geofabrik.WithTimeout(dur("timeout", c.Timeout)),
+	}
+	if ua := str("user-agent", c.UserAgent); ua != "" {
+		options = append(options, geofabrik.WithHeader("User-Agent", ua))
+	}
+
+	margin, err := parseBytes(str("space-margin", c.SpaceMargin))
+	if err != nil {
+		return ctx, err
+	}
+
+	provider, err := geofabrik.ProviderByName(str("provider", c.Provider))
+	if err != nil {
+		return ctx, err
+	}
+
+	host := str("host", c.Host)
+	if host == "" {
+		host = provider.DefaultHost()
+	}
+	g, err = geofabrik.NewClient(host, options...)
+	if err != nil {
+		return ctx, fmt.Errorf("could not init geofabrik client for %q: %w", host, err)
+	}
+	g.WithProvider(provider).WithSpaceMargin(margin).WithLogger(logger)
+
+	mirrors := cmd.StringSlice("mirror")
+	if !cmd.IsSet("mirror") {
+		mirrors = c.Mirrors
+	}
+	if g, err = g.WithMirrors(mirrors...); err != nil {
+		return ctx, fmt.Errorf("could not add mirrors: %w", err)
+	}
+	g.WithCoolDown(dur("cool-down", c.CoolDown))
+
+	segments := int(cmd.Int("segments"))
+	if !cmd.IsSet("segments") && c.Segments != 0 {
+		segments = c.Segments
+	}
+	g.WithSegments(segments)
+
+	limits := geofabrik.DefaultRequestLimits
+	limits.PerSecond = cmd.Float("request-rate")
+	if !cmd.IsSet("request-rate") && c.RequestRate != 0 {
+		limits.PerSecond = c.RequestRate
+	}
+	limits.MaxConcurrent = int(cmd.Int("max-connections"))
+	if !cmd.IsSet("max-connections") && c.MaxConnections != 0 {
+		limits.MaxConcurrent = c.MaxConnections
+	}
+	g.WithRequestLimits(limits)
+
+	lockWait := geofabrik.DefaultLockWait
+	if wait := dur("lock-wait", c.LockWait); wait > 0 {
+		lockWait = wait
+	}
+	if cmd.Bool("fail-if-locked") || (!cmd.IsSet("fail-if-locked") && c.FailIfLocked) {
+		lockWait = 0
+	}
+	g.WithLockWait(lockWait)
+
+	return ctx, nil
+}
+
+func newTransport(connectTimeout time.Duration, proxy, caBundle string) (*http.Transport, error) {
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return &http.Transport{}, errors.New("unexpected default transport")
+	}
+	t = t.Clone()
+
+	t.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	t.TLSHandshakeTimeout = connectTimeout
+
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return &http.Transport{}, fmt.Errorf("parsing proxy %q: %w", proxy, err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle) //nolint: gosec
+		if err != nil {
+			return &http.Transport{}, fmt.Errorf("reading ca bundle %q: %w", caBundle, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return &http.Transport{}, fmt.Errorf("no certificates found in ca bundle %q", caBundle)
+		}
+		t.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return t, nil
+}
+
+func init() {
+	clientFlags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config-file",
+			Usage:   "yaml file with the client settings below",
+			Sources: cli.EnvVars("GEOFABRIK_CONFIG_FILE"),
+		},
+		&cli.StringFlag{
+			Name:    "provider",
+			Value:   geofabrik.DefaultProvider.Name(),
+			Usage:   "where extracts are published, one of " + strings.Join(geofabrik.ProviderNames(), ", "),
+			Sources: cli.EnvVars("GEOFABRIK_PROVIDER"),
+		},
+		&cli.StringFlag{
+			Name:    "host",
+			Usage:   "server or mirror to download from, defaults to the one of the provider",
+			Sources: cli.EnvVars("GEOFABRIK_HOST"),
+		},
+		&cli.StringSliceFlag{
+			Name:    "mirror",
+			Usage:   "mirror to download from if the host fails, md5s always come from the host, repeatable",
+			Sources: cli.EnvVars("GEOFABRIK_MIRRORS"),
+		},
+		&cli.DurationFlag{
+			Name:    "cool-down",
+			Value:   geofabrik.DefaultCoolDown,
+			Usage:   "how long a host or mirror that failed is skipped",
+			Sources: cli.EnvVars("GEOFABRIK_COOL_DOWN"),
+		},
+		&cli.DurationFlag{
+			Name:    "timeout",
+			Usage:   "timeout of a whole request, 0 means none",
+			Sources: cli.EnvVars("GEOFABRIK_TIMEOUT"),
+		},
+		&cli.DurationFlag{
+			Name:    "connect-timeout",
+			Value:   30 * time.Second,
+			Usage:   "timeout to establish a connection",
+			Sources: cli.EnvVars("GEOFABRIK_CONNECT_TIMEOUT"),
+		},
+		&cli.StringFlag{
+			Name:    "proxy",
+			Usage:   "http proxy url, defaults to HTTP_PROXY/HTTPS_PROXY",
+			Sources: cli.EnvVars("GEOFABRIK_PROXY"),
+		},
+		&cli.StringFlag{
+			Name:    "ca-bundle",
+			Usage:   "pem file of additional certificate authorities to trust",
+			Sources: cli.EnvVars("GEOFABRIK_CA_BUNDLE"),
+		},
+		&cli.StringFlag{
+			Name:    "user-agent",
+			Usage:   "user agent to send (default: go-geofabrik/<version>)",
+			Sources: cli.EnvVars("GEOFABRIK_USER_AGENT"),
+		},
+		&cli.StringFlag{
+			Name:    "space-margin",
+			Value:   "100M",
+			Usage:   "free space to leave on disk after a download, 0 only checks the download fits",
+			Sources: cli.EnvVars("GEOFABRIK_SPACE_MARGIN"),
+		},
+		&cli.IntFlag{
+			Name:    "segments",
+			Value:   1,
+			Usage:   "download a pbf in n parallel byte ranges, verified against its md5",
+			Sources: cli.EnvVars("GEOFABRIK_SEGMENTS"),
+		},
+		&cli.FloatFlag{
+			Name:    "request-rate",
+			Value:   geofabrik.DefaultRequestLimits.PerSecond,
+			Usage:   "requests per second to the host, 0 means unlimited",
+			Sources: cli.EnvVars("GEOFABRIK_REQUEST_RATE"),
+		},
+		&cli.IntFlag{
+			Name:    "max-connections",
+			Value:   geofabrik.DefaultRequestLimits.MaxConcurrent,
+			Usage:   "requests to the host in flight at once, segments count individually, 0 means unlimited",
+			Sources: cli.EnvVars("GEOFABRIK_MAX_CONNECTIONS"),
+		},
+		&cli.DurationFlag{
+			Name:    "lock-wait",
+			Usage:   "how long to wait for another download of the same file, 0 waits as long as needed",
+			Sources: cli.EnvVars("GEOFABRIK_LOCK_WAIT"),
+		},
+		&cli.BoolFlag{
+			Name:    "fail-if-locked",
+			Usage:   "fail at once if another download of the same file is running",
+			Sources: cli.EnvVars("GEOFABRIK_FAIL_IF_LOCKED"),
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	geofabrik "github.com/iwpnd/go-geofabrik"
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	limitRateFlag cli.StringFlag
+	controlFlag   cli.StringFlag
+	// limiter throttles all downloads of g, watch adjusts it at runtime.
+	limiter = geofabrik.NewRateLimiter(0)
+	// metrics of g, watch serves them on the control endpoint.
+	metrics = geofabrik.NewPrometheusMetrics()
+)
+
+// useDownloader is the Before hook of commands that download.
+func useDownloader(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	ctx, err := useResolver(ctx, cmd)
+	if err != nil {
+		return ctx, err
+	}
+
+	if rate := cmd.String("limit-rate"); rate != "" {
+		n, err := parseBytes(rate)
+		if err != nil {
+			return ctx, err
+		}
+		limiter.SetLimit(n)
+	}
+	g.WithRateLimiter(limiter).WithMetrics(metrics)
+
+	return ctx, nil
+}
+
+// serveControl serves the control endpoint on addr until ctx is done.
+func serveControl(ctx context.Context, addr string, mux *http.ServeMux) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %q: %w", addr, err)
+	}
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("control endpoint failed", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx) //nolint: contextcheck
+	}()
+
+	return nil
+}
+
+// limitRate reports the rate limit on GET and changes it on PUT, e.g.
+// curl -X PUT -d 5M localhost:8089/limit-rate. 0 lifts the limit.
+func limitRate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		b, err := io.ReadAll(io.LimitReader(r.Body, 64))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, err := parseBytes(string(b))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limiter.SetLimit(n)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Fprintln(w, limiter.Limit())
+}
+
+func init() {
+	limitRateFlag = cli.StringFlag{
+		Name:    "limit-rate",
+		Usage:   "limit the bandwidth of downloads to bytes per second, e.g. 512K or 20M",
+		Sources: cli.EnvVars("GEOFABRIK_LIMIT_RATE"),
+		Action: func(_ context.Context, _ *cli.Command, v string) error {
+			_, err := parseBytes(v)
+			return err
+		},
+	}
+	controlFlag = cli.StringFlag{
+		Name:  "control",
+		Usage: "address to serve /limit-rate and /metrics on, e.g. localhost:8089",
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	geofabrik "github.com/iwpnd/go-geofabrik"
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	listCommand   cli.Command
+	searchCommand cli.Command
+	indexFlags    []cli.Flag
+)
+
+// region is the json output of a region.
+type region struct {
+	geofabrik.Region
+	Path     string   `json:"path"`
+	Size     int64    `json:"size,omitempty"`
+	Children []region `json:"children,omitempty"`
+}
+
+func defaultIndexCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "geofabrik", "index-v1-nogeom.json")
+}
+
+func loadIndex(ctx context.Context, cmd *cli.Command) (*geofabrik.Index, error) {
+	return g.CachedIndex(ctx, cmd.String("index-cache"), cmd.Duration("index-max-age"))
+}
+
+// useResolver is the Before hook of commands taking region names. Unless
+// disabled, names are checked against the cached index before downloading.
+func useResolver(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	if !cmd.Bool("resolve") {
+		return ctx, nil
+	}
+
+	idx, err := loadIndex(ctx, cmd)
+	if errors.Is(err, errors.ErrUnsupported) {
+		// names of providers without an index are taken as they are
+		return ctx, nil
+	}
+	if err != nil {
+		logger.Warn("could not load index, names are not checked", "error", err)
+		return ctx, nil
+	}
+	g.WithResolver(geofabrik.NewResolver(idx))
+
+	return ctx, nil
+}
+
+func list(ctx context.Context, cmd *cli.Command) error {
+	idx, err := loadIndex(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	parent := cmd.Args().First()
+	if parent != "" {
+		matches := idx.Search(parent)
+		if len(matches) == 0 {
+			return fmt.Errorf("unknown region %q", parent)
+		}
+		parent = matches[0].ID
+	}
+
+	tree, err := children(ctx, cmd, idx, parent)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput(cmd) {
+		printJSON(tree)
+		return nil
+	}
+
+	printTree(tree, 0)
+	return nil
+}
+
+func children(ctx context.Context, cmd *cli.Command, idx *geofabrik.Index, parent string) ([]region, error) {
+	out := []region{}
+	for _, r := range idx.Children(parent) {
+		node := region{Region: r, Path: r.Path()}
+
+		if cmd.Bool("sizes") {
+			size, err := g.Size(ctx, node.Path)
+			if err != nil {
+				return out, err
+			}
+			node.Size = size
+		}
+
+		c, err := children(ctx, cmd, idx, r.ID)
+		if err != nil {
+			return out, err
+		}
+		node.Children = c
+
+		out = append(out, node)
+	}
+
+	return out, nil
+}
+
+func printTree(tree []region, depth int) {
+	for _, r := range tree {
+		line := fmt.Sprintf("%s%s", strings.Repeat("  ", depth), r.Path)
+		line = fmt.Sprintf("%-60s [%s]", line, strings.Join(r.Formats(), ", "))
+		if r.Size > 0 {
+			line = fmt.Sprintf("%s %s", line, humanBytes(r.Size))
+		}
+		fmt.Println(line)
+
+		printTree(r.Children, depth+1)
+	}
+}
+
+func search(ctx context.Context, cmd *cli.Command) error {
+	term := strings.Join(cmd.Args().Slice(), " ")
+	if term == "" {
+		return fmt.Errorf("no search term given")
+	}
+
+	idx, err := loadIndex(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	matches := idx.Search(term)
+	if limit := int(cmd.Int("limit")); limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	out := make([]region, 0, len(matches))
+	for _, r := range matches {
+		out = append(out, region{Region: r, Path: r.Path()})
+	}
+
+	if jsonOutput(cmd) {
+		printJSON(out)
+		return nil
+	}
+
+	for _, r := range out {
+		codes := append(append([]string{}, r.ISO3166Alpha2...), r.ISO3166Subdivision...)
+		line := fmt.Sprintf("%-50s %s", r.Path, r.Name)
+		if len(codes) > 0 {
+			line = fmt.Sprintf("%s (%s)", line, strings.Join(codes, ", "))
+		}
+		fmt.Println(line)
+	}
+
+	return nil
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// parseBytes parses a size like 512K, 20M or 1.5G, units are powers of 1024.
+func parseBytes(s string) (int64, error) {
+	v := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := 1.0
+	if i := strings.IndexAny(v, "KMGT"); i >= 0 && i == len(v)-1 {
+		mult = math.Pow(1024, float64(strings.IndexByte("KMGT", v[i])+1))
+		v = v[:i]
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 512K, 20M or 1G", s)
+	}
+
+	return int64(n * mult), nil
+}
+
+func init() {
+	indexFlags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "index-cache",
+			Value:   defaultIndexCache(),
+			Usage:   "file to cache the geofabrik index in",
+			Sources: cli.EnvVars("GEOFABRIK_INDEX_CACHE"),
+		},
+		&cli.DurationFlag{
+			Name:    "index-max-age",
+			Value:   24 * time.Hour,
+			Usage:   "refresh the cached index once it is older",
+			Sources: cli.EnvVars("GEOFABRIK_INDEX_MAX_AGE"),
+		},
+		&cli.BoolFlag{
+			Name:    "resolve",
+			Value:   true,
+			Usage:   "check region names against the index and accept ids and ISO 3166 codes",
+			Sources: cli.EnvVars("GEOFABRIK_RESOLVE"),
+		},
+	}
+
+	listCommand = cli.Command{
+		Name:      "list",
+		Usage:     "list regions below parent as tree",
+		ArgsUsage: "[parent]",
+		Action:    list,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "sizes",
+				Usage: "look up the size of every pbf, one request per region",
+			},
+		},
+	}
+	searchCommand = cli.Command{
+		Name:      "search",
+		Usage:     "search regions by name, id or ISO 3166 code",
+		ArgsUsage: "<term>",
+		Action:    search,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "limit",
+				Value: 10,
+				Usage: "maximum number of results, 0 means all",
+			},
+		},
+	}
+}
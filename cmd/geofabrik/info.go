@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	geofabrik "github.com/iwpnd/go-geofabrik"
+	"github.com/urfave/cli/v3"
+)
+
+var infoCommand cli.Command
+
+// info is the json output of the info command.
+type info struct {
+	Region *region            `json:"region,omitempty"`
+	File   geofabrik.FileInfo `json:"file"`
+	MD5    string             `json:"md5"`
+}
+
+func showInfo(ctx context.Context, cmd *cli.Command) error {
+	name := cmd.Args().First()
+
+	stat, err := g.Stat(ctx, name, geofabrik.FileTypePBF)
+	if err != nil {
+		return report(cmd, result{Region: name}, err)
+	}
+	md5, err := g.MD5(ctx, name)
+	if err != nil {
+		return report(cmd, result{Region: name}, err)
+	}
+
+	out := info{File: stat, MD5: md5}
+	if r, ok := lookupRegion(ctx, cmd, name); ok {
+		out.Region = &region{Region: r, Path: r.Path()}
+	}
+
+	if jsonOutput(cmd) {
+		printJSON(out)
+		return nil
+	}
+
+	printInfo(out)
+	return nil
+}
+
+// lookupRegion returns the index entry of name. Without an index the info
+// command still shows what the server tells about the file.
+func lookupRegion(ctx context.Context, cmd *cli.Command, name string) (geofabrik.Region, bool) {
+	idx, err := loadIndex(ctx, cmd)
+	if err != nil {
+		logger.Warn("could not load index", "error", err)
+		return geofabrik.Region{}, false
+	}
+
+	path, err := geofabrik.NewResolver(idx).Resolve(name)
+	if err != nil {
+		return geofabrik.Region{}, false
+	}
+	for _, r := range idx.Regions {
+		if r.Path() == path {
+			return r, true
+		}
+	}
+
+	return geofabrik.Region{}, false
+}
+
+func printInfo(out info) {
+	row := func(key, value string) {
+		if value != "" {
+			fmt.Printf("%-14s %s\n", key, value)
+		}
+	}
+
+	if r := out.Region; r != nil {
+		row("region", r.Path)
+		row("name", r.Name)
+		row("parent", r.Parent)
+		row("formats", strings.Join(r.Formats(), ", "))
+		row("iso3166", strings.Join(append(append([]string{}, r.ISO3166Alpha2...), r.ISO3166Subdivision...), ", "))
+	}
+
+	f := out.File
+	row("url", f.URL)
+	if f.Size >= 0 {
+		row("size", fmt.Sprintf("%s (%d bytes)", humanBytes(f.Size), f.Size))
+	}
+	if !f.LastModified.IsZero() {
+		row("last modified", f.LastModified.Format(time.RFC3339))
+	}
+	row("etag", f.ETag)
+	row("ranges", fmt.Sprintf("%t", f.AcceptRanges))
+	row("md5", out.MD5)
+}
+
+func init() {
+	infoCommand = cli.Command{
+		Name:      "info",
+		Usage:     "show size, modification time and md5 of a dataset without downloading it",
+		ArgsUsage: "<region>",
+		Action:    showInfo,
+		Before:    useResolver,
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	logger   = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	logFlags []cli.Flag
+)
+
+// newLogger returns a logger writing to stderr in format, text or json.
+func newLogger(level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q, use debug, info, warn or error", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+}
+
+// setupLogger replaces the default logger with the one configured by the
+// log flags.
+func setupLogger(cmd *cli.Command) error {
+	l, err := newLogger(cmd.String("log-level"), cmd.String("log-format"))
+	if err != nil {
+		return err
+	}
+	logger = l
+
+	return nil
+}
+
+func validateLogFormat(_ context.Context, _ *cli.Command, v string) error {
+	_, err := newLogger("info", v)
+	return err
+}
+
+func init() {
+	logFlags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "log-level",
+			Value:   "warn",
+			Usage:   "log level to stderr, debug, info, warn or error",
+			Sources: cli.EnvVars("GEOFABRIK_LOG_LEVEL"),
+		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			Value:   "text",
+			Usage:   "log format, text or json",
+			Sources: cli.EnvVars("GEOFABRIK_LOG_FORMAT"),
+			Action:  validateLogFormat,
+		},
+	}
+}
@@ -1,123 +1,336 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	geofabrik "github.com/iwpnd/go-geofabrik"
-	"github.com/iwpnd/rip"
 	"github.com/urfave/cli/v3"
 )
 
 var (
 	g                        *geofabrik.Geofabrik
-	err                      error
 	latestMD5Command         cli.Command
 	polygonCommand           cli.Command
 	downloadCommand          cli.Command
 	downloadIfChangedCommand cli.Command
+	syncCommand              cli.Command
+	pruneCommand             cli.Command
+	watchCommand             cli.Command
 )
 
 var (
 	md5Flag        cli.StringFlag
 	outputPathFlag cli.StringFlag
+	configFlag     cli.StringFlag
+	dirFlag        cli.StringFlag
+	dryRunFlag     cli.BoolFlag
+	datedFlag      cli.BoolFlag
+	retentionFlags []cli.Flag
 )
 
 func latestMD5(ctx context.Context, cmd *cli.Command) error {
 	name := cmd.Args().First()
 	md5, err := g.MD5(ctx, name)
-	if err != nil {
-		return err
+	if err == nil && !jsonOutput(cmd) {
+		fmt.Println(md5)
 	}
 
-	fmt.Println(md5)
-	return nil
+	return report(cmd, result{Status: statusOK, Region: name, MD5: md5}, err)
 }
 
 func polygon(ctx context.Context, cmd *cli.Command) error {
 	name := cmd.Args().First()
+	res := result{Status: statusOK, Region: name}
+
 	polygon, err := g.Polygon(ctx, name)
 	if err != nil {
-		return err
+		return report(cmd, res, err)
 	}
 	f, err := polygon.ToFeature()
 	if err != nil {
-		return err
+		return report(cmd, res, err)
 	}
 
-	fmt.Println(f)
-	return nil
+	if !jsonOutput(cmd) {
+		fmt.Println(f)
+	}
+	res.Feature = json.RawMessage(f)
+
+	return report(cmd, res, nil)
 }
 
 func downloadIfChanged(ctx context.Context, cmd *cli.Command) error {
 	name := cmd.Args().First()
+	res := result{Region: name}
 
 	latestMD5, err := g.MD5(ctx, name)
 	if err != nil {
-		return err
+		return report(cmd, res, err)
 	}
+	res.MD5 = latestMD5
+
 	md5 := cmd.String("md5")
-	if md5 == latestMD5 {
-		fmt.Printf(
-			"%s is up to date, no download required (latest md5: %s, input md5: %s)\n\n",
-			name,
-			latestMD5,
-			md5,
-		)
-		return nil
+	if strings.EqualFold(md5, latestMD5) {
+		if !jsonOutput(cmd) {
+			fmt.Printf(
+				"%s is up to date, no download required (latest md5: %s, input md5: %s)\n\n",
+				name,
+				latestMD5,
+				md5,
+			)
+		}
+		res.Status = statusUpToDate
+		return report(cmd, res, nil)
 	}
 
+	return fetch(ctx, cmd, res)
+}
+
+func download(ctx context.Context, cmd *cli.Command) error {
+	return fetch(ctx, cmd, result{Region: cmd.Args().First()})
+}
+
+// fetch downloads the region of res and reports the outcome.
+func fetch(ctx context.Context, cmd *cli.Command, res result) error {
+	name := res.Region
 	outputPath := cmd.String("outputPath")
 
-	fmt.Printf("downloading %s (%s) \n\n", name, latestMD5)
-	err = g.Download(ctx, name, outputPath)
+	label := name
+	if res.MD5 != "" {
+		label = fmt.Sprintf("%s (%s)", name, res.MD5)
+	}
+
+	text := !jsonOutput(cmd)
+	if text {
+		fmt.Printf("downloading %s \n\n", label)
+	}
+	dr, err := g.DownloadWithResult(ctx, name, outputPath)
 	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			fmt.Printf("download canceled for %s (%s) \n\n", name, latestMD5)
-			return err
+		// other errors are printed once by main
+		if text && errors.Is(err, context.Canceled) {
+			return cli.Exit(fmt.Sprintf("download canceled for %s", label), exitFailed)
 		}
-		fmt.Printf("download error: %s \n\n", err)
+		return report(cmd, res, err)
+	}
+	if text {
+		fmt.Printf("\n\nfinished downloading %s", label)
+	}
+
+	res.Status = statusDownloaded
+	res.MD5 = dr.MD5
+	res.Path = dr.Path
+	res.Bytes = dr.Bytes
+	res.Duration = dr.Duration.Seconds()
+
+	return report(cmd, res, nil)
+}
+
+func syncManifest(ctx context.Context, cmd *cli.Command) error {
+	m, err := geofabrik.LoadManifest(cmd.String("config"))
+	if err != nil {
+		return err
+	}
+
+	dryRun := cmd.Bool("dry-run")
+	plan, err := g.Sync(ctx, m, cmd.String("dir"), geofabrik.SyncOptions{
+		DryRun:    dryRun,
+		Dated:     cmd.Bool("dated"),
+		Retention: retentionPolicy(cmd),
+	})
+	if jsonOutput(cmd) {
+		printJSON(struct {
+			*geofabrik.SyncPlan
+			Error string `json:"error,omitempty"`
+		}{plan, errString(err)})
+		if err != nil {
+			return cli.Exit("", exitFailed)
+		}
+		return nil
+	}
+
+	for _, item := range plan.Items {
+		line := fmt.Sprintf("%-8s %s (%s)", item.Action, item.Path, item.Reason)
+		if item.Bytes > 0 {
+			line = fmt.Sprintf("%s %s", line, humanBytes(item.Bytes))
+		}
+		fmt.Println(line)
+	}
+	if plan.Bytes > 0 {
+		fmt.Printf("\n%s to download\n", humanBytes(plan.Bytes))
+	}
+	if err != nil {
 		return err
 	}
-	fmt.Printf("\n\nfinished downloading %s (%s)", name, latestMD5)
+
+	if !dryRun {
+		fmt.Printf("\n\nfinished syncing %s", cmd.String("dir"))
+	}
 
 	return nil
 }
 
-func download(ctx context.Context, cmd *cli.Command) error {
-	name := cmd.Args().First()
+func prune(_ context.Context, cmd *cli.Command) error {
+	policy := retentionPolicy(cmd)
+	if policy.IsZero() {
+		return errors.New("no retention rule given, refusing to prune")
+	}
 
-	outputPath := cmd.String("outputPath")
+	dryRun := cmd.Bool("dry-run")
+	removed, err := geofabrik.Prune(cmd.String("dir"), policy, geofabrik.PruneOptions{
+		DryRun: dryRun,
+	})
+	if jsonOutput(cmd) {
+		printJSON(struct {
+			Removed []string `json:"removed"`
+			Error   string   `json:"error,omitempty"`
+		}{removed, errString(err)})
+		if err != nil {
+			return cli.Exit("", exitFailed)
+		}
+		return nil
+	}
 
-	fmt.Printf("downloading %s \n\n", name)
-	err = g.Download(ctx, name, outputPath)
+	for _, f := range removed {
+		fmt.Printf("remove   %s\n", f)
+	}
 	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			fmt.Printf("download canceled for %s \n\n", name)
+		return err
+	}
+
+	return nil
+}
+
+func retentionPolicy(cmd *cli.Command) geofabrik.RetentionPolicy {
+	return geofabrik.RetentionPolicy{
+		KeepLast:    int(cmd.Int("keep-last")),
+		KeepDaily:   int(cmd.Int("keep-daily")),
+		KeepMonthly: int(cmd.Int("keep-monthly")),
+	}
+}
+
+func watch(ctx context.Context, cmd *cli.Command) error {
+	names := cmd.Args().Slice()
+	if cmd.IsSet("config") {
+		m, err := geofabrik.LoadManifest(cmd.String("config"))
+		if err != nil {
 			return err
 		}
-		fmt.Printf("download error: %s \n\n", err)
+		for _, r := range m.Regions {
+			names = append(names, r.Name)
+		}
+	}
+	if len(names) == 0 {
+		return errors.New("no regions to watch")
+	}
+
+	dir := cmd.String("dir")
+	statePath := cmd.String("state")
+	if statePath == "" {
+		statePath = filepath.Join(dir, ".geofabrik-state.json")
+	}
+	state, err := geofabrik.LoadState(statePath)
+	if err != nil {
 		return err
 	}
-	fmt.Printf("\n\nfinished downloading %s", name)
 
-	return nil
+	if addr := cmd.String("control"); addr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/limit-rate", limitRate)
+		mux.Handle("/metrics", metrics)
+		if err := serveControl(ctx, addr, mux); err != nil {
+			return err
+		}
+	}
+
+	text := !jsonOutput(cmd)
+	if text {
+		fmt.Printf("watching %s every %s\n\n", strings.Join(names, ", "), cmd.Duration("interval"))
+	}
+	return g.Watch(ctx, names, geofabrik.WatchOptions{
+		Interval: cmd.Duration("interval"),
+		Dir:      dir,
+		State:    state,
+		OnDownload: func(ctx context.Context, dr geofabrik.DownloadResult) error {
+			if text {
+				fmt.Printf("downloaded %s (%s)\n", dr.Name, dr.MD5)
+			} else {
+				printJSON(result{
+					Status:   statusDownloaded,
+					Region:   dr.Name,
+					MD5:      dr.MD5,
+					Path:     dr.Path,
+					Bytes:    dr.Bytes,
+					Duration: dr.Duration.Seconds(),
+				})
+			}
+			return runHooks(ctx, cmd, dr)
+		},
+		OnError: func(name string, err error) {
+			if text {
+				fmt.Printf("watch error for %s: %s \n", name, err)
+				return
+			}
+			printJSON(result{Status: statusFailed, Region: name, Error: err.Error()})
+		},
+	})
 }
 
-func init() {
-	g, err = geofabrik.New(
-		"http://download.geofabrik.de",
-		rip.WithTimeout(0),
-	)
+// runHooks passes the result as json to the configured exec hook and webhook.
+func runHooks(ctx context.Context, cmd *cli.Command, result geofabrik.DownloadResult) error {
+	b, err := json.Marshal(result)
 	if err != nil {
-		panic("could not init geofabrik client")
+		return err
+	}
+
+	if hook := cmd.String("exec"); hook != "" {
+		c := exec.CommandContext(ctx, "sh", "-c", hook) //nolint: gosec
+		c.Stdin = bytes.NewReader(b)
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		c.Env = append(os.Environ(),
+			"GEOFABRIK_NAME="+result.Name,
+			"GEOFABRIK_PATH="+result.Path,
+			"GEOFABRIK_MD5="+result.MD5,
+		)
+		if err := c.Run(); err != nil {
+			return fmt.Errorf("running exec hook: %w", err)
+		}
 	}
 
+	if url := cmd.String("webhook"); url != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("creating webhook request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("calling webhook: %w", err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode >= 400 {
+			return fmt.Errorf("webhook responded with %s", res.Status)
+		}
+	}
+
+	return nil
+}
+
+func init() {
 	md5Flag = cli.StringFlag{
 		Name:     "md5",
 		Required: true,
@@ -128,34 +341,127 @@ func init() {
 		Required: true,
 		Usage:    "path to store dataset",
 	}
+	configFlag = cli.StringFlag{
+		Name:     "config",
+		Required: true,
+		Usage:    "yaml manifest of regions and formats",
+	}
+	dirFlag = cli.StringFlag{
+		Name:     "dir",
+		Required: true,
+		Usage:    "directory holding the datasets",
+	}
+	dryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print what would change without downloading or removing anything",
+	}
+	datedFlag = cli.BoolFlag{
+		Name:  "dated",
+		Usage: "keep dated copies of every download instead of replacing them",
+	}
+	retentionFlags = []cli.Flag{
+		&cli.IntFlag{
+			Name:  "keep-last",
+			Usage: "keep the newest n dated copies",
+		},
+		&cli.IntFlag{
+			Name:  "keep-daily",
+			Usage: "keep the newest dated copy of each of the last n days",
+		},
+		&cli.IntFlag{
+			Name:  "keep-monthly",
+			Usage: "keep the newest dated copy of each of the last n months",
+		},
+	}
 
 	latestMD5Command = cli.Command{
 		Name:   "md5",
 		Usage:  "get latest md5 of geofabrik dataset",
 		Action: latestMD5,
+		Before: useResolver,
 	}
 	polygonCommand = cli.Command{
 		Name:   "polygon",
 		Usage:  "get extent of dataset as geojson feature",
 		Action: polygon,
+		Before: useResolver,
 	}
 	downloadCommand = cli.Command{
 		Name:   "download",
 		Usage:  "download dataset to outputpath",
 		Action: download,
+		Before: useDownloader,
 		Flags: []cli.Flag{
 			&outputPathFlag,
+			&limitRateFlag,
 		},
 	}
 	downloadIfChangedCommand = cli.Command{
 		Name:   "download-if-changed",
 		Usage:  "download dataset to outputpath if md5 changed",
 		Action: downloadIfChanged,
+		Before: useDownloader,
 		Flags: []cli.Flag{
 			&md5Flag,
 			&outputPathFlag,
+			&limitRateFlag,
+		},
+	}
+	syncCommand = cli.Command{
+		Name:   "sync",
+		Usage:  "sync directory with the regions listed in a manifest",
+		Action: syncManifest,
+		Before: useDownloader,
+		Flags: append([]cli.Flag{
+			&configFlag,
+			&dirFlag,
+			&dryRunFlag,
+			&datedFlag,
+			&limitRateFlag,
+		}, retentionFlags...),
+	}
+	watchCommand = cli.Command{
+		Name:      "watch",
+		Usage:     "periodically download datasets whose md5 changed",
+		ArgsUsage: "[region...]",
+		Action:    watch,
+		Before:    useDownloader,
+		Flags: []cli.Flag{
+			&dirFlag,
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "yaml manifest of regions to watch in addition to the arguments",
+			},
+			&cli.StringFlag{
+				Name:  "state",
+				Usage: "file to persist the last seen md5s in (default: <dir>/.geofabrik-state.json)",
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Value: time.Hour,
+				Usage: "time between two checks",
+			},
+			&cli.StringFlag{
+				Name:  "exec",
+				Usage: "shell command to run after a download, receives the result as json on stdin",
+			},
+			&cli.StringFlag{
+				Name:  "webhook",
+				Usage: "url to POST the result of a download to as json",
+			},
+			&limitRateFlag,
+			&controlFlag,
 		},
 	}
+	pruneCommand = cli.Command{
+		Name:   "prune",
+		Usage:  "remove dated copies in a directory according to a retention policy",
+		Action: prune,
+		Flags: append([]cli.Flag{
+			&dirFlag,
+			&dryRunFlag,
+		}, retentionFlags...),
+	}
 }
 
 func main() {
@@ -167,11 +473,11 @@ func main() {
 
 	go func() {
 		<-sigCh
-		fmt.Println("shutdown requested; cleaning up…")
+		fmt.Fprintln(os.Stderr, "shutdown requested; cleaning up…")
 
 		go func() {
 			<-sigCh
-			fmt.Println("forced exit")
+			fmt.Fprintln(os.Stderr, "forced exit")
 			os.Exit(1)
 		}()
 
@@ -181,17 +487,28 @@ func main() {
 	}()
 
 	app := &cli.Command{
-		Name:  "geofabrik",
-		Usage: "geofabrik",
+		Name:   "geofabrik",
+		Usage:  "geofabrik",
+		Before: setupClient,
+		Flags: append(append(append([]cli.Flag{
+			&outputFlag,
+		}, logFlags...), clientFlags...), indexFlags...),
 		Commands: []*cli.Command{
 			&latestMD5Command,
 			&polygonCommand,
+			&infoCommand,
 			&downloadCommand,
 			&downloadIfChangedCommand,
+			&syncCommand,
+			&pruneCommand,
+			&watchCommand,
+			&listCommand,
+			&searchCommand,
 		},
 	}
 
 	if err := app.Run(shutdownCtx, os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1) //nolint:gocritic
 	}
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	statusOK         = "ok"
+	statusDownloaded = "downloaded"
+	statusUpToDate   = "up-to-date"
+	statusCanceled   = "canceled"
+	statusFailed     = "failed"
+)
+
+// exit codes of json output, so callers can tell the outcome apart without
+// parsing it.
+const (
+	exitFailed   = 1
+	exitUpToDate = 3
+)
+
+var outputFlag cli.StringFlag
+
+// result is the json output of a command.
+type result struct {
+	Status   string          `json:"status"`
+	Region   string          `json:"region,omitempty"`
+	MD5      string          `json:"md5,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	Bytes    int64           `json:"bytes,omitempty"`
+	Duration float64         `json:"duration,omitempty"`
+	Feature  json.RawMessage `json:"feature,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+func jsonOutput(cmd *cli.Command) bool {
+	return cmd.String("output") == "json"
+}
+
+// printJSON writes v as a single line of json to stdout.
+func printJSON(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not marshal output: %s\n", err)
+		return
+	}
+	fmt.Println(string(b))
+}
+
+// report prints res in json mode and maps its status to the exit code.
+// In text mode the caller has already printed its prose, up to date is a
+// success there.
+func report(cmd *cli.Command, res result, err error) error {
+	if err != nil {
+		res.Status = statusFailed
+		if errors.Is(err, context.Canceled) {
+			res.Status = statusCanceled
+		}
+		res.Error = err.Error()
+	}
+
+	if jsonOutput(cmd) {
+		printJSON(res)
+	}
+
+	switch res.Status {
+	case statusUpToDate:
+		// text mode keeps 0, scripts may rely on it being a success
+		if jsonOutput(cmd) {
+			return cli.Exit("", exitUpToDate)
+		}
+		return nil
+	case statusFailed, statusCanceled:
+		if jsonOutput(cmd) {
+			// the error is part of the output already
+			return cli.Exit("", exitFailed)
+		}
+		return err
+	default:
+		return nil
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func validateOutput(_ context.Context, _ *cli.Command, v string) error {
+	switch v {
+	case "text", "json":
+		return nil
+	default:
+		return fmt.Errorf("unknown output %q, use text or json", v)
+	}
+}
+
+func init() {
+	outputFlag = cli.StringFlag{
+		Name:   "output",
+		Value:  "text",
+		Usage:  "output format, text or json",
+		Action: validateOutput,
+	}
+}
@@ -1,6 +1,28 @@
 package geofabrik
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors the typed errors of this package match with errors.Is.
+var (
+	// ErrNotFound the dataset does not exist (anymore).
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited the server asks to slow down.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrServerError the server failed, retrying later may help.
+	ErrServerError = errors.New("server error")
+	// ErrChecksumMismatch the content does not match its md5.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrNotModified the content did not change since the time a conditional
+	// request asked about, e.g. when CachedIndex revalidates its cache.
+	ErrNotModified = errors.New("not modified")
+	// ErrLocked another writer holds the lock of the destination.
+	ErrLocked = errors.New("locked")
+)
 
 type EmptyNameError struct{}
 
@@ -8,10 +30,23 @@ func (e EmptyNameError) Error() string {
 	return "name is empty"
 }
 
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid name %q: %s", e.Name, e.Reason)
+}
+
+// DownloadFailedError is returned if a request fails. Code is 0 if there was
+// no response at all, Err holds the cause then. Otherwise Message holds the
+// start of the response.
 type DownloadFailedError struct {
 	URL     string
 	Message string
 	Code    int
+	Err     error
 }
 
 func (e DownloadFailedError) Error() string {
@@ -22,10 +57,162 @@ func (e DownloadFailedError) Error() string {
 	)
 }
 
+func (e DownloadFailedError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel error of the status code.
+func (e DownloadFailedError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == http.StatusNotFound || e.Code == http.StatusGone
+	case ErrRateLimited:
+		return e.Code == http.StatusTooManyRequests
+	case ErrServerError:
+		return e.Code >= http.StatusInternalServerError
+	case ErrNotModified:
+		return e.Code == http.StatusNotModified
+	default:
+		return false
+	}
+}
+
 type CopyFailedError struct {
 	Message string
+	Err     error
 }
 
 func (e CopyFailedError) Error() string {
 	return fmt.Sprintf("failed to save file: %s", e.Message)
 }
+
+func (e CopyFailedError) Unwrap() error {
+	return e.Err
+}
+
+type ChecksumMismatchError struct {
+	Expected string
+	Got      string
+}
+
+func (e ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected %s, got %s", e.Expected, e.Got)
+}
+
+func (e ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// InvalidChecksumError is returned if a checksum file is not in md5sum
+// format or does not belong to the requested dataset, e.g. because a proxy
+// answered with an html page.
+type InvalidChecksumError struct {
+	URL     string
+	Content string
+	Reason  string
+}
+
+func (e InvalidChecksumError) Error() string {
+	if e.Content == "" {
+		return fmt.Sprintf("invalid checksum from %q: %s", e.URL, e.Reason)
+	}
+
+	return fmt.Sprintf("invalid checksum %q from %q: %s", e.Content, e.URL, e.Reason)
+}
+
+// InsufficientSpaceError is returned before a download that would not leave
+// the configured margin free on the filesystem of Path.
+type InsufficientSpaceError struct {
+	Path      string
+	Required  int64
+	Available int64
+}
+
+func (e InsufficientSpaceError) Error() string {
+	return fmt.Sprintf(
+		"insufficient space in %q: %d bytes required, %d bytes available",
+		e.Path,
+		e.Required,
+		e.Available,
+	)
+}
+
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e UnknownFormatError) Error() string {
+	return fmt.Sprintf("unknown format: %q", e.Format)
+}
+
+type DuplicateFileError struct {
+	Filename string
+}
+
+func (e DuplicateFileError) Error() string {
+	return fmt.Sprintf("more than one dataset is stored as %q", e.Filename)
+}
+
+type UnknownRegionError struct {
+	Name        string
+	Suggestions []string
+}
+
+func (e UnknownRegionError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("unknown region %q", e.Name)
+	}
+
+	return fmt.Sprintf(
+		"unknown region %q, did you mean: %s",
+		e.Name,
+		strings.Join(e.Suggestions, ", "),
+	)
+}
+
+type HostMismatchError struct {
+	Host     string
+	Expected string
+}
+
+func (e HostMismatchError) Error() string {
+	return fmt.Sprintf("host %q does not match configured host %q", e.Host, e.Expected)
+}
+
+type UnknownProviderError struct {
+	Name  string
+	Known []string
+}
+
+func (e UnknownProviderError) Error() string {
+	return fmt.Sprintf("unknown provider %q, use one of: %s", e.Name, strings.Join(e.Known, ", "))
+}
+
+// UnsupportedError is returned if a Provider does not publish what is
+// requested, e.g. an index. It matches errors.ErrUnsupported.
+type UnsupportedError struct {
+	Provider string
+	Feature  string
+}
+
+func (e UnsupportedError) Error() string {
+	return fmt.Sprintf("%s does not support %s", e.Provider, e.Feature)
+}
+
+func (e UnsupportedError) Is(target error) bool {
+	return target == errors.ErrUnsupported
+}
+
+// LockedError is returned if another process or goroutine downloads to
+// Path and waiting for it is not configured or took too long.
+type LockedError struct {
+	Path string
+}
+
+func (e LockedError) Error() string {
+	return fmt.Sprintf("%q is locked by another download", e.Path)
+}
+
+func (e LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
@@ -0,0 +1,91 @@
+package geofabrik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	type tcase struct {
+		err  error
+		want []error
+	}
+
+	sentinels := []error{
+		ErrNotFound,
+		ErrRateLimited,
+		ErrServerError,
+		ErrChecksumMismatch,
+		ErrNotModified,
+	}
+
+	tests := map[string]tcase{
+		"not found": {
+			err:  DownloadFailedError{Code: http.StatusNotFound},
+			want: []error{ErrNotFound},
+		},
+		"gone": {
+			err:  DownloadFailedError{Code: http.StatusGone},
+			want: []error{ErrNotFound},
+		},
+		"rate limited": {
+			err:  DownloadFailedError{Code: http.StatusTooManyRequests},
+			want: []error{ErrRateLimited},
+		},
+		"server error": {
+			err:  DownloadFailedError{Code: http.StatusBadGateway},
+			want: []error{ErrServerError},
+		},
+		"not modified": {
+			err:  DownloadFailedError{Code: http.StatusNotModified},
+			want: []error{ErrNotModified},
+		},
+		"forbidden": {
+			err:  DownloadFailedError{Code: http.StatusForbidden},
+			want: []error{},
+		},
+		"network error": {
+			err:  DownloadFailedError{Err: context.Canceled},
+			want: []error{context.Canceled},
+		},
+		"checksum mismatch": {
+			err:  ChecksumMismatchError{Expected: "a", Got: "b"},
+			want: []error{ErrChecksumMismatch},
+		},
+		"wrapped": {
+			err:  fmt.Errorf("syncing: %w", DownloadFailedError{Code: http.StatusNotFound}),
+			want: []error{ErrNotFound},
+		},
+		"copy failed": {
+			err:  CopyFailedError{Err: context.DeadlineExceeded},
+			want: []error{context.DeadlineExceeded},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, want := range tc.want {
+				assert.ErrorIs(t, tc.err, want)
+			}
+			for _, sentinel := range sentinels {
+				if !contains(tc.want, sentinel) {
+					assert.False(t, errors.Is(tc.err, sentinel), "unexpected match of %q", sentinel)
+				}
+			}
+		})
+	}
+}
+
+func contains(errs []error, target error) bool {
+	for _, err := range errs {
+		if err == target { //nolint: errorlint
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,387 @@
+// Package geofabriktest provides a fake download server to test code using
+// a geofabrik.Downloader against.
+package geofabriktest
+
+import (
+	"bytes"
+	"crypto/md5" //nolint: gosec
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	geofabrik "github.com/iwpnd/go-geofabrik"
+)
+
+// Region is a dataset served by a Server.
+type Region struct {
+	// Name of the dataset, e.g. europe/germany/berlin.
+	Name string
+	// Data is served as the pbf.
+	Data []byte
+	// Poly is served as the polygon, defaults to a unit square.
+	Poly string
+	// LastModified is sent with the pbf, defaults to the time it was added.
+	LastModified time.Time
+}
+
+// MD5 returns the md5 of the pbf.
+func (r Region) MD5() string {
+	sum := md5.Sum(r.Data) //nolint: gosec
+	return hex.EncodeToString(sum[:])
+}
+
+// Fault is what a Server does instead of answering a request normally.
+type Fault struct {
+	// Status is sent without a body, e.g. 503.
+	Status int
+	// Drop sends the headers and half of the body, then closes the
+	// connection.
+	Drop bool
+	// Corrupt serves the body with a flipped byte, it won't match its md5.
+	Corrupt bool
+}
+
+type injected struct {
+	fault Fault
+	// times left, forever if negative
+	times int
+}
+
+// Server is a fake download server. It serves the pbf, md5 and poly of
+// every Region as well as an index of all of them, in the layout of a
+// Provider. Faults can be injected per file.
+type Server struct {
+	*httptest.Server
+	mu         sync.Mutex
+	provider   geofabrik.Provider
+	regions    map[string]Region
+	faults     map[string][]*injected
+	requests   map[string]int
+	ranges     bool
+	latency    time.Duration
+	throughput int
+}
+
+// NewServer starts a Server without any regions. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		provider: geofabrik.DefaultProvider,
+		regions:  map[string]Region{},
+		faults:   map[string][]*injected{},
+		requests: map[string]int{},
+		ranges:   true,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// NewClient returns a geofabrik client for the server, options are applied
+// after the ones connecting it to the server.
+func (s *Server) NewClient(options ...geofabrik.Option) (*geofabrik.Geofabrik, error) {
+	options = append([]geofabrik.Option{geofabrik.WithHTTPClient(s.Client())}, options...)
+	g, err := geofabrik.NewClient(s.URL, options...)
+	if err != nil {
+		return g, err
+	}
+
+	return g.WithProvider(s.provider), nil
+}
+
+// WithProvider serves files in the layout of p instead of Geofabrik's.
+func (s *Server) WithProvider(p geofabrik.Provider) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.provider = p
+	return s
+}
+
+// WithoutRanges ignores Range headers and always sends the whole file.
+func (s *Server) WithoutRanges() *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ranges = false
+	return s
+}
+
+// WithLatency delays every response by d.
+func (s *Server) WithLatency(d time.Duration) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+	return s
+}
+
+// WithThroughput sends bodies at about bytesPerSecond, 0 means unlimited.
+func (s *Server) WithThroughput(bytesPerSecond int) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throughput = bytesPerSecond
+	return s
+}
+
+// Add serves r, replacing a region of the same name.
+func (s *Server) Add(r Region) Region {
+	if r.Poly == "" {
+		r.Poly = fmt.Sprintf("%s\n1\n   0   0\n   1   0\n   1   1\n   0   1\n   0   0\nEND\nEND\n", path.Base(r.Name))
+	}
+	if r.LastModified.IsZero() {
+		r.LastModified = time.Now().UTC().Truncate(time.Second)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.regions[r.Name] = r
+
+	return r
+}
+
+// AddRegion serves a region with size bytes of synthetic data. The data
+// only depends on name and size.
+func (s *Server) AddRegion(name string, size int) Region {
+	return s.Add(Region{Name: name, Data: Synthetic(name, size)})
+}
+
+// Region returns the region called name.
+func (s *Server) Region(name string) (Region, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.regions[name]
+	return r, ok
+}
+
+// Inject makes the next times requests for the file of type ftype of the
+// region name fail with f. times below 1 fail all requests.
+func (s *Server) Inject(name string, ftype geofabrik.FileType, f Fault, times int) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uri, err := s.provider.URI(name, ftype, "")
+	if err != nil {
+		panic(fmt.Sprintf("geofabriktest: %s", err))
+	}
+	if times < 1 {
+		times = -1
+	}
+	s.faults[uri] = append(s.faults[uri], &injected{fault: f, times: times})
+
+	return s
+}
+
+// Requests returns how many requests were made for the file of type ftype
+// of the region name.
+func (s *Server) Requests(name string, ftype geofabrik.FileType) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uri, err := s.provider.URI(name, ftype, "")
+	if err != nil {
+		return 0
+	}
+	return s.requests[uri]
+}
+
+// Synthetic returns size bytes of data that only depend on seed.
+func Synthetic(seed string, size int) []byte {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(seed))
+	rng := rand.New(rand.NewPCG(h.Sum64(), uint64(size))) //nolint: gosec
+
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(rng.UintN(256))
+	}
+
+	return data
+}
+
+// lookup returns the region and FileType uri belongs to.
+func (s *Server) lookup(uri string) (Region, geofabrik.FileType, bool) {
+	for _, r := range s.regions {
+		for _, ftype := range []geofabrik.FileType{geofabrik.FileTypePBF, geofabrik.FileTypeMD5, geofabrik.FileTypePoly} {
+			if u, err := s.provider.URI(r.Name, ftype, ""); err == nil && u == uri {
+				return r, ftype, true
+			}
+		}
+	}
+
+	return Region{}, "", false
+}
+
+// fault returns the next fault injected for uri, if any.
+func (s *Server) fault(uri string) (Fault, bool) {
+	for _, inj := range s.faults[uri] {
+		if inj.times == 0 {
+			continue
+		}
+		if inj.times > 0 {
+			inj.times--
+		}
+		return inj.fault, true
+	}
+
+	return Fault{}, false
+}
+
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	uri := req.URL.Path
+	s.requests[uri]++
+	fault, faulty := s.fault(uri)
+	latency, throughput, ranges := s.latency, s.throughput, s.ranges
+
+	var (
+		body     []byte
+		modified time.Time
+		found    = true
+	)
+	if uri == s.provider.IndexURI() && uri != "" {
+		body = s.index()
+	} else {
+		r, ftype, ok := s.lookup(uri)
+		found = ok
+		switch ftype { //nolint: exhaustive
+		case geofabrik.FileTypePBF:
+			body, modified = r.Data, r.LastModified
+		case geofabrik.FileTypeMD5:
+			pbf, _ := s.provider.URI(r.Name, geofabrik.FileTypePBF, "")
+			body = []byte(r.MD5() + "  " + path.Base(pbf) + "\n")
+		case geofabrik.FileTypePoly:
+			body = []byte(r.Poly)
+		}
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	switch {
+	case faulty && fault.Status != 0:
+		w.WriteHeader(fault.Status)
+		return
+	case !found:
+		http.NotFound(w, req)
+		return
+	case faulty && fault.Corrupt && len(body) > 0:
+		body = bytes.Clone(body)
+		body[len(body)/2] ^= 0xff
+	}
+
+	if faulty && fault.Drop {
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body[:len(body)/2])
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	var out http.ResponseWriter = w
+	if throughput > 0 {
+		out = &slowWriter{ResponseWriter: w, req: req, bytesPerSecond: throughput}
+	}
+
+	if ranges {
+		w.Header().Set("ETag", `"`+hashOf(body)+`"`)
+		http.ServeContent(out, req, "", modified, bytes.NewReader(body))
+		return
+	}
+
+	// ServeContent would announce and serve ranges
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		_, _ = out.Write(body)
+	}
+}
+
+// index returns the regions as geojson index without geometries.
+func (s *Server) index() []byte {
+	type feature struct {
+		Type       string           `json:"type"`
+		Properties geofabrik.Region `json:"properties"`
+	}
+
+	names := make([]string, 0, len(s.regions))
+	for name := range s.regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	features := make([]feature, 0, len(names))
+	for _, name := range names {
+		uri, err := s.provider.URI(name, geofabrik.FileTypePBF, "")
+		if err != nil {
+			continue
+		}
+		r := geofabrik.Region{
+			ID:   path.Base(name),
+			Name: path.Base(name),
+			URLs: map[string]string{"pbf": s.URL + uri},
+		}
+		if dir := path.Dir(name); dir != "." {
+			r.Parent = path.Base(dir)
+		}
+		features = append(features, feature{Type: "Feature", Properties: r})
+	}
+
+	b, _ := json.Marshal(map[string]any{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+	return b
+}
+
+func hashOf(b []byte) string {
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// slowWriter writes at about bytesPerSecond.
+type slowWriter struct {
+	http.ResponseWriter
+	req            *http.Request
+	bytesPerSecond int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	chunk := max(w.bytesPerSecond/10, 1)
+	written := 0
+	for written < len(p) {
+		n := min(chunk, len(p)-written)
+		m, err := w.ResponseWriter.Write(p[written : written+n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		if f, ok := w.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		select {
+		case <-time.After(time.Duration(n) * time.Second / time.Duration(w.bytesPerSecond)):
+		case <-w.req.Context().Done():
+			return written, w.req.Context().Err()
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,207 @@
+package geofabriktest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	geofabrik "github.com/iwpnd/go-geofabrik"
+	"github.com/iwpnd/go-geofabrik/geofabriktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func setup(t *testing.T) (*geofabriktest.Server, *geofabrik.Geofabrik) {
+	t.Helper()
+	srv := geofabriktest.NewServer()
+	t.Cleanup(srv.Close)
+
+	g, err := srv.NewClient()
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	return srv, g
+}
+
+func TestServer(t *testing.T) {
+	srv, g := setup(t)
+	berlin := srv.AddRegion("europe/germany/berlin", 256<<10)
+	srv.AddRegion("europe/germany", 512<<10)
+	ctx := context.Background()
+
+	md5, err := g.MD5(ctx, "europe/germany/berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, berlin.MD5(), md5)
+
+	dir := t.TempDir()
+	if err := g.Download(ctx, "europe/germany/berlin", dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "berlin.osm.pbf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, berlin.Data, got)
+
+	p, err := g.Polygon(ctx, "europe/germany/berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := p.ToFeature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, f, `[[[0,0],[1,0],[1,1],[0,1],[0,0]]]`)
+
+	idx, err := g.Index(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := idx.Get("berlin")
+	assert.True(t, ok)
+	assert.Equal(t, "germany", r.Parent)
+	assert.Equal(t, "europe/germany/berlin", r.Path())
+
+	assert.Equal(t, 1, srv.Requests("europe/germany/berlin", geofabrik.FileTypePBF))
+	assert.Equal(t, 0, srv.Requests("europe/germany", geofabrik.FileTypePBF))
+
+	_, err = g.MD5(ctx, "nope")
+	assert.ErrorIs(t, err, geofabrik.ErrNotFound)
+}
+
+func TestServerRanges(t *testing.T) {
+	srv, g := setup(t)
+	srv.AddRegion("europe", 1<<20)
+	g.WithSegments(4)
+
+	if err := g.Download(context.Background(), "europe", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// HEAD plus four segments
+	assert.Equal(t, 5, srv.Requests("europe", geofabrik.FileTypePBF))
+
+	srv.WithoutRanges()
+	if err := g.Download(context.Background(), "europe", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// HEAD plus one GET
+	assert.Equal(t, 7, srv.Requests("europe", geofabrik.FileTypePBF))
+}
+
+func TestServerFaults(t *testing.T) {
+	type tcase struct {
+		fault    geofabrik.FileType
+		inject   geofabriktest.Fault
+		segments int
+		expected error
+	}
+
+	tests := map[string]tcase{
+		"should fail with server error": {
+			fault:    geofabrik.FileTypePBF,
+			inject:   geofabriktest.Fault{Status: 503},
+			expected: geofabrik.ErrServerError,
+		},
+		"should fail with rate limit": {
+			fault:    geofabrik.FileTypeMD5,
+			inject:   geofabriktest.Fault{Status: 429},
+			segments: 2,
+			expected: geofabrik.ErrRateLimited,
+		},
+		"should detect corrupt body": {
+			fault:    geofabrik.FileTypePBF,
+			inject:   geofabriktest.Fault{Corrupt: true},
+			segments: 2,
+			expected: geofabrik.ErrChecksumMismatch,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, g := setup(t)
+			srv.AddRegion("europe", 256<<10)
+			srv.Inject("europe", tc.fault, tc.inject, 0)
+			g.WithSegments(tc.segments)
+
+			err := g.Download(context.Background(), "europe", t.TempDir())
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+func TestServerDrop(t *testing.T) {
+	srv, g := setup(t)
+	srv.AddRegion("europe", 256<<10)
+	srv.Inject("europe", geofabrik.FileTypePBF, geofabriktest.Fault{Drop: true}, 1)
+
+	dir := t.TempDir()
+	assert.Error(t, g.Download(context.Background(), "europe", dir))
+	assert.NoFileExists(t, filepath.Join(dir, "europe.osm.pbf"))
+
+	// the fault was injected once
+	assert.NoError(t, g.Download(context.Background(), "europe", dir))
+	assert.FileExists(t, filepath.Join(dir, "europe.osm.pbf"))
+}
+
+func TestServerDropFailover(t *testing.T) {
+	srv, _ := setup(t)
+	mirror, _ := setup(t)
+	europe := srv.AddRegion("europe", 256<<10)
+	mirror.Add(europe)
+	srv.Inject("europe", geofabrik.FileTypePBF, geofabriktest.Fault{Drop: true}, -1)
+
+	g, err := srv.NewClient()
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	if g, err = g.WithMirrors(mirror.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	assert.NoError(t, g.Download(context.Background(), "europe", dir))
+	assert.FileExists(t, filepath.Join(dir, "europe.osm.pbf"))
+	assert.Equal(t, 1, srv.Requests("europe", geofabrik.FileTypePBF))
+	assert.Equal(t, 1, mirror.Requests("europe", geofabrik.FileTypePBF))
+}
+
+func TestServerSlow(t *testing.T) {
+	srv, g := setup(t)
+	srv.AddRegion("europe", 64<<10)
+	srv.WithThroughput(16 << 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := g.Download(ctx, "europe", t.TempDir())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), 2*time.Second)
+}
+
+func TestServerProvider(t *testing.T) {
+	srv, _ := setup(t)
+	srv.WithProvider(geofabrik.BBBikeProvider{})
+	berlin := srv.AddRegion("Berlin", 128<<10)
+
+	g, err := srv.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := g.Checksum(context.Background(), "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, berlin.MD5(), c.Hash)
+	assert.Equal(t, "Berlin.osm.pbf", c.Filename)
+}
+
+func TestSynthetic(t *testing.T) {
+	assert.Equal(t, geofabriktest.Synthetic("a", 100), geofabriktest.Synthetic("a", 100))
+	assert.NotEqual(t, geofabriktest.Synthetic("a", 100), geofabriktest.Synthetic("b", 100))
+	assert.Len(t, geofabriktest.Synthetic("a", 100), 100)
+}
@@ -0,0 +1,359 @@
+package geofabrik
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Region is a dataset listed in the Geofabrik index.
+type Region struct {
+	ID     string            `json:"id"`
+	Parent string            `json:"parent,omitempty"`
+	Name   string            `json:"name"`
+	URLs   map[string]string `json:"urls"`
+	// ISO3166Alpha2 are the ISO 3166-1 alpha 2 country codes, e.g. DE.
+	ISO3166Alpha2 []string `json:"iso3166-1:alpha2,omitempty"`
+	// ISO3166Subdivision are the ISO 3166-2 subdivision codes, e.g. DE-BE.
+	ISO3166Subdivision []string `json:"iso3166-2,omitempty"`
+}
+
+// Path returns the name of the region as accepted by Download, e.g.
+// europe/germany/berlin.
+func (r Region) Path() string {
+	u, err := url.Parse(r.URLs["pbf"])
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(
+		strings.TrimPrefix(u.Path, "/"),
+		"-latest"+string(FileTypePBF),
+	)
+}
+
+// Formats returns the formats the region is available in.
+func (r Region) Formats() []string {
+	out := make([]string, 0, len(r.URLs))
+	for f := range r.URLs {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Index is the catalogue of datasets Geofabrik offers.
+type Index struct {
+	Regions []Region
+	byID    map[string]int
+}
+
+// ParseIndex parses the geojson index published by Geofabrik.
+func ParseIndex(data []byte) (*Index, error) {
+	fc := struct {
+		Features []struct {
+			Properties Region `json:"properties"`
+		} `json:"features"`
+	}{}
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return &Index{}, fmt.Errorf("parsing index: %w", err)
+	}
+
+	idx := &Index{
+		Regions: make([]Region, 0, len(fc.Features)),
+		byID:    map[string]int{},
+	}
+	for i, f := range fc.Features {
+		idx.Regions = append(idx.Regions, f.Properties)
+		idx.byID[f.Properties.ID] = i
+	}
+
+	return idx, nil
+}
+
+// Get returns the region with the id.
+func (i *Index) Get(id string) (Region, bool) {
+	n, ok := i.byID[id]
+	if !ok {
+		return Region{}, false
+	}
+
+	return i.Regions[n], true
+}
+
+// Children returns the regions whose parent is the given id, sorted by id.
+// An empty parent returns the top level regions.
+func (i *Index) Children(parent string) []Region {
+	out := []Region{}
+	for _, r := range i.Regions {
+		if r.Parent == parent {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool {
+		return out[a].ID < out[b].ID
+	})
+
+	return out
+}
+
+// Search returns the regions matching term best first. Ids, names and
+// ISO 3166 codes are matched case insensitive, allowing for typos.
+func (i *Index) Search(term string) []Region {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return []Region{}
+	}
+
+	type match struct {
+		region Region
+		score  int
+	}
+
+	matches := []match{}
+	for _, r := range i.Regions {
+		best := -1
+		for _, candidate := range r.keys() {
+			s := score(term, candidate)
+			if s >= 0 && (best < 0 || s < best) {
+				best = s
+			}
+		}
+		if best >= 0 {
+			matches = append(matches, match{region: r, score: best})
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].score != matches[b].score {
+			return matches[a].score < matches[b].score
+		}
+		return matches[a].region.ID < matches[b].region.ID
+	})
+
+	out := make([]Region, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, m.region)
+	}
+
+	return out
+}
+
+// keys returns the lower cased strings a region can be found by.
+func (r Region) keys() []string {
+	keys := []string{
+		strings.ToLower(r.ID),
+		strings.ToLower(r.Name),
+		strings.ToLower(r.Path()),
+	}
+	for _, code := range r.ISO3166Alpha2 {
+		keys = append(keys, strings.ToLower(code))
+	}
+	for _, code := range r.ISO3166Subdivision {
+		keys = append(keys, strings.ToLower(code))
+	}
+
+	return keys
+}
+
+// score rates how well term matches candidate, lower is better. It returns
+// -1 if they do not match at all.
+func score(term, candidate string) int {
+	switch {
+	case candidate == "":
+		return -1
+	case term == candidate:
+		return 0
+	case strings.HasPrefix(candidate, term):
+		return 1
+	case strings.Contains(candidate, term):
+		return 2
+	}
+
+	d := levenshtein(term, candidate)
+	if d > maxTypos(term) {
+		return -1
+	}
+
+	return 2 + d
+}
+
+// maxTypos is the edit distance still considered a match for term. Short
+// terms like country codes have to match exactly.
+func maxTypos(term string) int {
+	return utf8.RuneCountInString(term) / 4
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// Index fetches the catalogue of datasets.
+func (g *Geofabrik) Index(ctx context.Context) (*Index, error) {
+	data, err := g.fetchIndex(ctx, time.Time{})
+	if err != nil {
+		return &Index{}, err
+	}
+
+	return ParseIndex(data)
+}
+
+// CachedIndex returns the catalogue of datasets cached at path. The cache is
+// refreshed once it is older than maxAge, unless the server reports the index
+// not modified since the cache was written. If refreshing fails, a stale
+// cache is used instead, if writing the cache fails, the index is returned
+// regardless.
+func (g *Geofabrik) CachedIndex(ctx context.Context, path string, maxAge time.Duration) (*Index, error) {
+	if _, err := g.indexURI(); err != nil {
+		return &Index{}, err
+	}
+
+	info, statErr := os.Stat(path)
+	if statErr == nil && time.Since(info.ModTime()) < maxAge {
+		if idx, err := readIndex(path); err == nil {
+			g.meter().Add(MetricIndexCache, Labels{"result": "hit"}, 1)
+			return idx, nil
+		}
+	}
+
+	var since time.Time
+	if statErr == nil {
+		since = info.ModTime()
+	}
+
+	data, err := g.fetchIndex(ctx, since)
+	if errors.Is(err, ErrNotModified) {
+		if idx, err := readIndex(path); err == nil {
+			g.meter().Add(MetricIndexCache, Labels{"result": "not-modified"}, 1)
+			now := time.Now()
+			_ = os.Chtimes(path, now, now)
+			return idx, nil
+		}
+		data, err = g.fetchIndex(ctx, time.Time{})
+	}
+	if err != nil {
+		if statErr == nil && !errors.Is(err, context.Canceled) {
+			g.meter().Add(MetricIndexCache, Labels{"result": "stale"}, 1)
+			return readIndex(path)
+		}
+		return &Index{}, err
+	}
+	g.meter().Add(MetricIndexCache, Labels{"result": "miss"}, 1)
+
+	idx, err := ParseIndex(data)
+	if err != nil {
+		return &Index{}, err
+	}
+
+	// the index is usable even if it cannot be cached
+	if err := writeIndex(path, data); err != nil {
+		g.logger().Warn("could not cache index", "path", path, "error", err)
+	}
+
+	return idx, nil
+}
+
+// writeIndex caches data at path. The temporary file is created next to
+// path, not in GEOFABRIK_TMPDIR, so that it can be renamed.
+func writeIndex(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("creating directory of %q: %w", path, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".index-")
+	if err != nil {
+		return fmt.Errorf("creating temporary index file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing index: %w", err)
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func readIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path) //nolint: gosec
+	if err != nil {
+		return &Index{}, fmt.Errorf("reading cached index %q: %w", path, err)
+	}
+
+	return ParseIndex(data)
+}
+
+// fetchIndex downloads the index. Unless since is zero, the request is
+// conditional and fails with ErrNotModified if the index did not change.
+func (g *Geofabrik) fetchIndex(ctx context.Context, since time.Time) ([]byte, error) {
+	uri, err := g.indexURI()
+	if err != nil {
+		return []byte{}, err
+	}
+
+	header := map[string]string{"Accept": "application/json"}
+	if !since.IsZero() {
+		header["If-Modified-Since"] = since.UTC().Format(http.TimeFormat)
+	}
+
+	var body []byte
+	err = g.failover(ctx, func(h *upstream) error {
+		res, err := g.do(ctx, h, "GET", uri, header)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		body, err = io.ReadAll(res.Body)
+		return err
+	})
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return body, nil
+}
+
+// indexURI returns the path of the index of the Provider, or an
+// UnsupportedError if it has none.
+func (g *Geofabrik) indexURI() (string, error) {
+	uri := g.Provider().IndexURI()
+	if uri == "" {
+		return "", UnsupportedError{Provider: g.Provider().Name(), Feature: "an index"}
+	}
+
+	return uri, nil
+}
@@ -0,0 +1,238 @@
+package geofabrik
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTestIndex(t *testing.T) *Index {
+	t.Helper()
+	b, err := os.ReadFile("testdata/index-v1-nogeom.json")
+	if err != nil {
+		t.Fatal("could not read index fixture", err)
+	}
+	idx, err := ParseIndex(b)
+	if err != nil {
+		t.Fatal("could not parse index fixture", err)
+	}
+	return idx
+}
+
+func TestRegionPath(t *testing.T) {
+	idx := loadTestIndex(t)
+
+	tests := map[string]string{
+		"europe":     "europe",
+		"germany":    "europe/germany",
+		"berlin":     "europe/germany/berlin",
+		"us/georgia": "north-america/us/georgia",
+	}
+
+	for id, expected := range tests {
+		t.Run(id, func(t *testing.T) {
+			r, ok := idx.Get(id)
+			assert.True(t, ok)
+			assert.Equal(t, expected, r.Path())
+		})
+	}
+}
+
+func TestIndexChildren(t *testing.T) {
+	idx := loadTestIndex(t)
+
+	ids := func(regions []Region) []string {
+		out := []string{}
+		for _, r := range regions {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"asia", "europe"}, ids(idx.Children("")))
+	assert.Equal(t, []string{"berlin", "brandenburg"}, ids(idx.Children("germany")))
+	assert.Empty(t, idx.Children("berlin"))
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := loadTestIndex(t)
+
+	type tcase struct {
+		term     string
+		expected string
+	}
+
+	tests := map[string]tcase{
+		"should find by id": {
+			term:     "berlin",
+			expected: "berlin",
+		},
+		"should find by name": {
+			term:     "Ireland and Northern Ireland",
+			expected: "ireland-and-northern-ireland",
+		},
+		"should find by country code": {
+			term:     "de",
+			expected: "germany",
+		},
+		"should find by subdivision code": {
+			term:     "DE-BE",
+			expected: "berlin",
+		},
+		"should find by prefix": {
+			term:     "brand",
+			expected: "brandenburg",
+		},
+		"should find with typo": {
+			term:     "germny",
+			expected: "germany",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := idx.Search(tc.term)
+			if len(got) == 0 {
+				t.Fatal("expected a match")
+			}
+			assert.Equal(t, tc.expected, got[0].ID)
+		})
+	}
+
+	assert.Empty(t, idx.Search("atlantis"))
+}
+
+func TestCachedIndex(t *testing.T) {
+	teardown := setupTestServer(nil)
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "index.json")
+
+	idx, err := g.CachedIndex(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatal("failed to get index", err)
+	}
+	assert.Len(t, idx.Regions, 8)
+	assert.FileExists(t, path)
+
+	// a stale cache is used when the server is gone
+	teardown()
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err = g.CachedIndex(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatal("failed to get stale index", err)
+	}
+	assert.Len(t, idx.Regions, 8)
+}
+
+func TestCachedIndexNotModified(t *testing.T) {
+	b, err := os.ReadFile("testdata/index-v1-nogeom.json")
+	if err != nil {
+		t.Fatal("could not read index fixture", err)
+	}
+
+	var index atomic.Pointer[[]byte]
+	index.Store(&b)
+	var modified atomic.Int64
+	modified.Store(time.Now().Add(-3 * time.Hour).Unix())
+	var notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !time.Unix(modified.Load(), 0).After(since) {
+			notModified.Add(1)
+		}
+		http.ServeContent(w, r, "", time.Unix(modified.Load(), 0), bytes.NewReader(*index.Load()))
+	}))
+	t.Cleanup(srv.Close)
+
+	g, err := New(srv.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "index.json")
+	stale := func() {
+		old := time.Now().Add(-2 * time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := g.CachedIndex(ctx, path, time.Hour); err != nil {
+		t.Fatal("failed to get index", err)
+	}
+
+	// unchanged since the cache was written, it is kept and fresh again
+	stale()
+	idx, err := g.CachedIndex(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatal("failed to revalidate index", err)
+	}
+	assert.Len(t, idx.Regions, 8)
+	assert.Equal(t, int32(1), notModified.Load())
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Less(t, time.Since(info.ModTime()), time.Minute)
+
+	// changed, it is downloaded again
+	stale()
+	changed := []byte(`{"type": "FeatureCollection", "features": []}`)
+	index.Store(&changed)
+	modified.Store(time.Now().Unix())
+
+	idx, err = g.CachedIndex(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatal("failed to refresh index", err)
+	}
+	assert.Empty(t, idx.Regions)
+	assert.Equal(t, int32(1), notModified.Load())
+}
+
+func TestCachedIndexWrite(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	// not even a directory, the cache must not be staged there
+	blocked := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocked, []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GEOFABRIK_TMPDIR", blocked)
+
+	path := filepath.Join(t.TempDir(), "cache", "index.json")
+	idx, err := g.CachedIndex(t.Context(), path, time.Hour)
+	if err != nil {
+		t.Fatal("failed to get index", err)
+	}
+	assert.Len(t, idx.Regions, 8)
+	assert.FileExists(t, path)
+
+	// a cache that cannot be written is skipped
+	idx, err = g.CachedIndex(t.Context(), filepath.Join(blocked, "index.json"), time.Hour)
+	if err != nil {
+		t.Fatal("failed to get index", err)
+	}
+	assert.Len(t, idx.Regions, 8)
+}
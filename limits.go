@@ -0,0 +1,144 @@
+package geofabrik
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RequestLimits keep a client from hammering a host. They apply per host to
+// every request, including the ones of downloads, whose connection counts
+// until the body is closed.
+type RequestLimits struct {
+	// PerSecond is the number of requests per second started at a host,
+	// 0 means unlimited.
+	PerSecond float64
+	// Burst is the number of requests started at once before PerSecond
+	// applies, at least 1.
+	Burst int
+	// MaxConcurrent is the number of requests to a host in flight at once,
+	// 0 means unlimited. Segments of a download count individually.
+	MaxConcurrent int
+}
+
+// DefaultRequestLimits are the RequestLimits of a new client.
+var DefaultRequestLimits = RequestLimits{
+	PerSecond:     4,
+	Burst:         8,
+	MaxConcurrent: 4,
+}
+
+// WithRequestLimits replaces the RequestLimits of g.
+func (g *Geofabrik) WithRequestLimits(limits RequestLimits) *Geofabrik {
+	g.gates = newGates(limits)
+	return g
+}
+
+// gates hands out a gate per host.
+type gates struct {
+	limits RequestLimits
+	mu     sync.Mutex
+	byHost map[string]*gate
+}
+
+func newGates(limits RequestLimits) *gates {
+	return &gates{
+		limits: limits,
+		byHost: map[string]*gate{},
+	}
+}
+
+// acquire blocks until a request to host may start. release has to be
+// called once the request is done.
+func (gs *gates) acquire(ctx context.Context, host string) (release func(), err error) {
+	gs.mu.Lock()
+	g, ok := gs.byHost[host]
+	if !ok {
+		g = newGate(gs.limits)
+		gs.byHost[host] = g
+	}
+	gs.mu.Unlock()
+
+	return g.acquire(ctx)
+}
+
+// gate limits the requests to a single host.
+type gate struct {
+	slots  chan struct{}
+	rate   float64
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newGate(limits RequestLimits) *gate {
+	g := &gate{
+		rate:   limits.PerSecond,
+		burst:  float64(max(limits.Burst, 1)),
+		tokens: float64(max(limits.Burst, 1)),
+		last:   time.Now(),
+	}
+	if limits.MaxConcurrent > 0 {
+		g.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+
+	return g
+}
+
+func (g *gate) acquire(ctx context.Context) (func(), error) {
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		case <-ctx.Done():
+			return func() {}, ctx.Err()
+		}
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if g.slots != nil {
+				<-g.slots
+			}
+		})
+	}
+
+	if err := g.wait(ctx); err != nil {
+		release()
+		return func() {}, err
+	}
+
+	return release, nil
+}
+
+// wait blocks until the token bucket allows another request.
+func (g *gate) wait(ctx context.Context) error {
+	if g.rate <= 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	now := time.Now()
+	g.tokens = min(g.tokens+now.Sub(g.last).Seconds()*g.rate, g.burst)
+	g.last = now
+	g.tokens--
+	var delay time.Duration
+	if g.tokens < 0 {
+		delay = time.Duration(-g.tokens / g.rate * float64(time.Second))
+	}
+	g.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package geofabrik
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iwpnd/rip"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLimitsConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	g, err := New(server.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithRequestLimits(RequestLimits{MaxConcurrent: 2})
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = g.Size(t.Context(), "foo")
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), peak.Load())
+}
+
+func TestRequestLimitsRate(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithRequestLimits(RequestLimits{PerSecond: 10, Burst: 2})
+
+	start := time.Now()
+	for range 6 {
+		if _, err := g.Size(t.Context(), "foo"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// two requests from the burst, four more at 10 per second
+	assert.GreaterOrEqual(t, time.Since(start), 350*time.Millisecond)
+}
+
+func TestUserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	g, err := New(server.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	if _, err := g.Size(t.Context(), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, DefaultUserAgent, got)
+
+	g, err = New(server.URL, rip.WithDefaultHeaders(rip.Header{"User-Agent": "data-platform/1.0"}))
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	if _, err := g.Size(t.Context(), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "data-platform/1.0", got)
+}
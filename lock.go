@@ -0,0 +1,65 @@
+package geofabrik
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLockWait makes downloads wait for other writers of the same
+// destination as long as their context allows.
+const DefaultLockWait time.Duration = -1
+
+// lockPoll is how often a locked destination is checked.
+const lockPoll = 100 * time.Millisecond
+
+// WithLockWait sets how long a download waits for another process or
+// goroutine that downloads to the same destination. Zero fails at once with
+// a LockedError, a negative duration waits as long as the context allows.
+func (g *Geofabrik) WithLockWait(d time.Duration) *Geofabrik {
+	g.lockWait = d
+	return g
+}
+
+// lockPath returns the lock file of dest, a hidden file next to it that is
+// removed again on unlock.
+func lockPath(dest string) string {
+	return filepath.Join(filepath.Dir(dest), "."+filepath.Base(dest)+".lock")
+}
+
+// lock takes the advisory lock of dest, waiting as configured. The lock is
+// held until unlock is called.
+func (g *Geofabrik) lock(ctx context.Context, dest string) (unlock func(), err error) {
+	path := lockPath(dest)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("creating directory of %q: %w", dest, err)
+	}
+
+	started := time.Now()
+	for {
+		release, ok, err := tryLock(path)
+		if err != nil {
+			return nil, fmt.Errorf("locking %q: %w", dest, err)
+		}
+		if ok {
+			return func() {
+				if err := release(); err != nil {
+					g.logger().Warn("could not release lock", "path", path, "error", err)
+				}
+			}, nil
+		}
+
+		if g.lockWait == 0 || (g.lockWait > 0 && time.Since(started) >= g.lockWait) {
+			return nil, LockedError{Path: dest}
+		}
+		g.logger().Debug("waiting for lock", "path", path)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
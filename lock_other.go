@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || freebsd)
+
+package geofabrik
+
+import (
+	"os"
+)
+
+// tryLock creates path exclusively, there is no flock. ok is false if the
+// file exists. A lock file left by a crashed process has to be removed by
+// hand.
+func tryLock(path string) (release func() error, ok bool, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640) //nolint: gosec
+	if os.IsExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return func() error {
+		_ = f.Close()
+		return os.Remove(path)
+	}, true, nil
+}
@@ -0,0 +1,185 @@
+package geofabrik
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockDownload(t *testing.T) {
+	type tcase struct {
+		wait    time.Duration
+		release time.Duration
+		timeout time.Duration
+		err     error
+	}
+
+	fn := func(tc tcase) func(*testing.T) {
+		return func(t *testing.T) {
+			data := patternData(minSegmentSize)
+			m := setupMirror(t, data, data, 0)
+
+			g, err := New(m.URL)
+			if err != nil {
+				t.Fatal("could not initialize client")
+			}
+			g.WithLockWait(tc.wait)
+
+			dir := t.TempDir()
+			dest := filepath.Join(dir, "foo.osm.pbf")
+			unlock, err := g.lock(context.Background(), dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			released := make(chan struct{})
+			go func() {
+				defer close(released)
+				time.Sleep(tc.release)
+				unlock()
+			}()
+			t.Cleanup(func() { <-released })
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+
+			err = g.Download(ctx, "foo", dir)
+			<-released
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				assert.False(t, fileExists(dir, "foo.osm.pbf"))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, fileExists(dir, "foo.osm.pbf"))
+			assert.False(t, fileExists(dir, ".foo.osm.pbf.lock"))
+		}
+	}
+
+	tests := map[string]tcase{
+		"fail if locked": {
+			wait:    0,
+			release: 100 * time.Millisecond,
+			timeout: time.Second,
+			err:     ErrLocked,
+		},
+		"wait until released": {
+			wait:    DefaultLockWait,
+			release: 200 * time.Millisecond,
+			timeout: 5 * time.Second,
+		},
+		"wait too long": {
+			wait:    150 * time.Millisecond,
+			release: time.Second,
+			timeout: 5 * time.Second,
+			err:     ErrLocked,
+		},
+		"canceled while waiting": {
+			wait:    DefaultLockWait,
+			release: time.Second,
+			timeout: 150 * time.Millisecond,
+			err:     context.DeadlineExceeded,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, fn(tc))
+	}
+}
+
+func TestLockExclusive(t *testing.T) {
+	g, err := New("http://localhost")
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithLockWait(0)
+
+	dest := filepath.Join(t.TempDir(), "foo.osm.pbf")
+	unlock, err := g.lock(context.Background(), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = g.lock(context.Background(), dest)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	unlock()
+	unlock, err = g.lock(context.Background(), dest)
+	assert.NoError(t, err)
+	unlock()
+}
+
+// setupMismatch returns a client whose download of foo fails its checksum
+// after it was written to a temporary file, in segments or at once.
+func setupMismatch(t *testing.T, segments int) *Geofabrik {
+	t.Helper()
+	data := patternData(4 * minSegmentSize)
+	published := patternData(4*minSegmentSize + 1)
+	m := setupMirror(t, data, published, 0)
+
+	g, err := New(m.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	// payload from a mirror is verified even if not segmented
+	if g, err = g.WithMirrors(setupMirror(t, data, published, 0).URL); err != nil {
+		t.Fatal(err)
+	}
+
+	return g.WithSegments(segments)
+}
+
+func TestFailedDownloadCleanup(t *testing.T) {
+	type tcase struct {
+		segments int
+	}
+
+	fn := func(tc tcase) func(*testing.T) {
+		return func(t *testing.T) {
+			t.Run("keeps existing dir", func(t *testing.T) {
+				g := setupMismatch(t, tc.segments)
+
+				dir := t.TempDir()
+				if err := os.WriteFile(filepath.Join(dir, "bar.osm.pbf"), []byte("bar"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				err := g.Download(context.Background(), "foo", dir)
+				assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Len(t, entries, 1)
+				assert.Equal(t, "bar.osm.pbf", entries[0].Name())
+			})
+
+			t.Run("removes created tmp dir", func(t *testing.T) {
+				g := setupMismatch(t, tc.segments)
+
+				tDir := filepath.Join(t.TempDir(), "tmp")
+				t.Setenv("GEOFABRIK_TMPDIR", tDir)
+
+				err := g.Download(context.Background(), "foo", t.TempDir())
+				assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+				_, err = os.Stat(tDir)
+				assert.True(t, os.IsNotExist(err))
+			})
+		}
+	}
+
+	tests := map[string]tcase{
+		"at once":     {segments: 1},
+		"in segments": {segments: 2},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, fn(tc))
+	}
+}
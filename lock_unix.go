@@ -0,0 +1,54 @@
+//go:build linux || darwin || freebsd
+
+package geofabrik
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive flock on path without blocking. ok is false if
+// someone else holds it.
+func tryLock(path string) (release func() error, ok bool, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o640) //nolint: gosec
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) //nolint: gosec
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		_ = f.Close()
+		return nil, false, nil
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, false, err
+	}
+
+	// the holder before us may have removed path while we waited for it
+	if !samePath(f, path) {
+		_ = f.Close()
+		return nil, false, nil
+	}
+
+	return func() error {
+		// remove before closing, which releases the lock
+		_ = os.Remove(path)
+		return f.Close()
+	}, true, nil
+}
+
+// samePath reports whether path still refers to the open file f.
+func samePath(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(fi, pi)
+}
@@ -0,0 +1,20 @@
+package geofabrik
+
+import "log/slog"
+
+// WithLogger sets the logger requests, failovers, finished downloads,
+// checksum results and the removal of temporary files are reported to.
+// Nothing is logged by default.
+func (g *Geofabrik) WithLogger(l *slog.Logger) *Geofabrik {
+	g.log = l
+	return g
+}
+
+// logger returns the configured logger or one that discards everything.
+func (g *Geofabrik) logger() *slog.Logger {
+	if g.log == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+
+	return g.log
+}
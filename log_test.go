@@ -0,0 +1,74 @@
+package geofabrik
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordLogs returns a logger and a func returning the messages it logged.
+func recordLogs(t *testing.T) (*slog.Logger, func() []string) {
+	t.Helper()
+	var buf bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	return l, func() []string {
+		msgs := []string{}
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var e struct{ Msg string }
+			if err := dec.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			msgs = append(msgs, e.Msg)
+		}
+		return msgs
+	}
+}
+
+func TestLogDownload(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	m := setupMirror(t, data, data, 0)
+
+	g, err := New(m.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	l, logged := recordLogs(t)
+	g.WithLogger(l).WithSegments(2)
+
+	if err := g.Download(context.Background(), "foo", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := logged()
+	assert.Contains(t, msgs, "request started")
+	assert.Contains(t, msgs, "request finished")
+	assert.Contains(t, msgs, "checksum verified")
+	assert.Equal(t, "download finished", msgs[len(msgs)-1])
+}
+
+func TestLogChecksumMismatch(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	m := setupMirror(t, data, patternData(4*minSegmentSize+1), 0)
+
+	g, err := New(m.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	l, logged := recordLogs(t)
+	g.WithLogger(l).WithSegments(2)
+
+	err = g.Download(context.Background(), "foo", t.TempDir())
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	msgs := logged()
+	assert.Contains(t, msgs, "checksum mismatch")
+	assert.Contains(t, msgs, "removed temporary file")
+	assert.Contains(t, msgs, "host failed, trying the next one")
+	assert.Equal(t, "download failed", msgs[len(msgs)-1])
+}
@@ -0,0 +1,90 @@
+package geofabrik
+
+import (
+	"strconv"
+	"time"
+)
+
+// Names of the metrics a Geofabrik reports.
+const (
+	// MetricRequests counts requests by host, method and status code, the
+	// code is "error" if no response was received.
+	MetricRequests = "geofabrik_requests_total"
+	// MetricRequestDuration observes the seconds until the response
+	// headers of a request arrived.
+	MetricRequestDuration = "geofabrik_request_duration_seconds"
+	// MetricDownloads counts downloads by result, ok or failed.
+	MetricDownloads = "geofabrik_downloads_total"
+	// MetricDownloadDuration observes the seconds a successful download
+	// took.
+	MetricDownloadDuration = "geofabrik_download_duration_seconds"
+	// MetricDownloadBytes counts the bytes of successful downloads.
+	MetricDownloadBytes = "geofabrik_download_bytes_total"
+	// MetricFailovers counts hosts that failed and were skipped.
+	MetricFailovers = "geofabrik_failovers_total"
+	// MetricChecksumMismatches counts downloads that did not match their
+	// md5.
+	MetricChecksumMismatches = "geofabrik_checksum_mismatches_total"
+	// MetricIndexCache counts lookups of the cached index by result, hit,
+	// miss, not-modified or stale.
+	MetricIndexCache = "geofabrik_index_cache_total"
+)
+
+// Labels tell apart the series of a metric, e.g. {"host": "example.com"}.
+type Labels map[string]string
+
+// Metrics receives the measurements of a Geofabrik. Implementations have to
+// be safe for concurrent use.
+type Metrics interface {
+	// Add adds delta to the counter name.
+	Add(name string, labels Labels, delta float64)
+	// Observe records value in the histogram name.
+	Observe(name string, labels Labels, value float64)
+}
+
+// NopMetrics discards all measurements, it is the default.
+type NopMetrics struct{}
+
+func (NopMetrics) Add(string, Labels, float64) {}
+
+func (NopMetrics) Observe(string, Labels, float64) {}
+
+// WithMetrics sets where the client reports its measurements to.
+func (g *Geofabrik) WithMetrics(m Metrics) *Geofabrik {
+	g.metrics = m
+	return g
+}
+
+// meter returns the configured Metrics or NopMetrics.
+func (g *Geofabrik) meter() Metrics {
+	if g.metrics == nil {
+		return NopMetrics{}
+	}
+
+	return g.metrics
+}
+
+// observeDownload reports the outcome of a download.
+func (g *Geofabrik) observeDownload(result DownloadResult, err error) {
+	if err != nil {
+		g.meter().Add(MetricDownloads, Labels{"result": "failed"}, 1)
+		return
+	}
+
+	g.meter().Add(MetricDownloads, Labels{"result": "ok"}, 1)
+	g.meter().Add(MetricDownloadBytes, nil, float64(result.Bytes))
+	g.meter().Observe(MetricDownloadDuration, nil, result.Duration.Seconds())
+}
+
+// observeRequest reports a request to host, code is its status code or 0 if
+// there was no response.
+func (g *Geofabrik) observeRequest(host, method string, code int, started time.Time) {
+	status := "error"
+	if code != 0 {
+		status = strconv.Itoa(code)
+	}
+
+	labels := Labels{"host": host, "method": method, "code": status}
+	g.meter().Add(MetricRequests, labels, 1)
+	g.meter().Observe(MetricRequestDuration, Labels{"host": host, "method": method}, time.Since(started).Seconds())
+}
@@ -0,0 +1,154 @@
+package geofabrik
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultCoolDown is how long a host that failed is skipped.
+const DefaultCoolDown = 5 * time.Minute
+
+// upstream is a server datasets are requested from.
+type upstream struct {
+	url    *url.URL
+	client doer
+}
+
+// urlOf returns the absolute url of uri on h.
+func (h *upstream) urlOf(uri string) string {
+	return strings.TrimSuffix(h.url.String(), "/") + uri
+}
+
+// health remembers the hosts that failed recently.
+type health struct {
+	coolDown time.Duration
+	mu       sync.Mutex
+	down     map[*upstream]time.Time
+}
+
+func newHealth(coolDown time.Duration) *health {
+	return &health{coolDown: coolDown, down: map[*upstream]time.Time{}}
+}
+
+// WithMirrors adds mirrors that payload is downloaded from. The host of g
+// and the mirrors are tried in order, a host that fails with a connection
+// error, a server error or a checksum mismatch is skipped for the
+// cool-down period. Checksums are only ever fetched from the host of g and
+// downloads of a pbf are verified against them, so a mirror cannot serve
+// anything but the published file.
+func (g *Geofabrik) WithMirrors(mirrors ...string) (*Geofabrik, error) {
+	for _, m := range mirrors {
+		h, err := g.dial(m)
+		if err != nil {
+			return g, err
+		}
+		g.hosts = append(g.hosts, h)
+	}
+
+	return g, nil
+}
+
+// WithCoolDown sets how long a host that failed is skipped, the default is
+// DefaultCoolDown.
+func (g *Geofabrik) WithCoolDown(d time.Duration) *Geofabrik {
+	g.health = newHealth(d)
+	return g
+}
+
+// authoritative is the host checksums are fetched from.
+func (g *Geofabrik) authoritative() *upstream {
+	return g.hosts[0]
+}
+
+// mirrored reports whether payload may come from another host than the
+// authoritative one.
+func (g *Geofabrik) mirrored() bool {
+	return len(g.hosts) > 1
+}
+
+// healthy returns the hosts to try in order. If all of them failed
+// recently, all of them are tried anyway.
+func (g *Geofabrik) healthy() []*upstream {
+	g.health.mu.Lock()
+	defer g.health.mu.Unlock()
+
+	now := time.Now()
+	out := []*upstream{}
+	for _, h := range g.hosts {
+		if until, ok := g.health.down[h]; ok && now.Before(until) {
+			continue
+		}
+		out = append(out, h)
+	}
+	if len(out) == 0 {
+		return g.hosts
+	}
+
+	return out
+}
+
+func (g *Geofabrik) markDown(h *upstream) {
+	g.health.mu.Lock()
+	defer g.health.mu.Unlock()
+
+	g.health.down[h] = time.Now().Add(g.health.coolDown)
+}
+
+// failover calls fn with the healthy hosts in order until it succeeds or
+// fails with an error another host would not fail with.
+func (g *Geofabrik) failover(ctx context.Context, fn func(h *upstream) error) error {
+	var err error
+	for _, h := range g.healthy() {
+		err = fn(h)
+		if err == nil || !hostFailed(ctx, err) {
+			return err
+		}
+		g.logger().Warn("host failed, trying the next one", "host", h.url.Host, "error", err)
+		g.meter().Add(MetricFailovers, Labels{"host": h.url.Host}, 1)
+		g.markDown(h)
+	}
+
+	return err
+}
+
+// hostFailed reports whether err is the fault of the host.
+func hostFailed(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ErrServerError) || errors.Is(err, ErrChecksumMismatch) {
+		return true
+	}
+
+	var failed DownloadFailedError
+	if errors.As(err, &failed) {
+		return failed.Code == 0
+	}
+
+	var copyFailed CopyFailedError
+	return errors.As(err, &copyFailed) && readFailed(copyFailed.Err)
+}
+
+// readFailed reports whether err, the cause of a CopyFailedError, is the
+// connection breaking off rather than a local error. A nil cause is a body
+// that ended early.
+func readFailed(err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &netErr)
+}
@@ -0,0 +1,166 @@
+package geofabrik
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mirrorServer struct {
+	*httptest.Server
+	pbf atomic.Int32
+	md5 atomic.Int32
+}
+
+// setupMirror serves data as foo-latest.osm.pbf, or fails with status if it
+// is not 0. The md5 is always the one of published.
+func setupMirror(t *testing.T, data, published []byte, status int) *mirrorServer {
+	t.Helper()
+	m := &mirrorServer{}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/foo-latest.osm.pbf":
+			m.pbf.Add(1)
+			if status != 0 {
+				w.WriteHeader(status)
+				return
+			}
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		case "/foo-latest.osm.pbf.md5":
+			m.md5.Add(1)
+			fmt.Fprintf(w, "%s  foo-latest.osm.pbf\n", md5Hex(published))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+func TestMirrorFailover(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	corrupt := patternData(4*minSegmentSize + 1)
+
+	primary := setupMirror(t, data, data, http.StatusServiceUnavailable)
+	bad := setupMirror(t, corrupt, corrupt, 0)
+	good := setupMirror(t, data, data, 0)
+
+	g, err := New(primary.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g, err = g.WithMirrors(bad.URL, good.URL)
+	if err != nil {
+		t.Fatal("could not add mirrors", err)
+	}
+
+	dir := t.TempDir()
+	result, err := g.DownloadWithResult(t.Context(), "foo", dir)
+	if err != nil {
+		t.Fatal("failed to download", err)
+	}
+	assert.Equal(t, md5Hex(data), result.MD5)
+
+	got, err := os.ReadFile(filepath.Join(dir, "foo.osm.pbf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, bytes.Equal(data, got))
+
+	// the md5 comes from the primary only
+	assert.Equal(t, int32(1), primary.md5.Load())
+	assert.Equal(t, int32(0), bad.md5.Load())
+	assert.Equal(t, int32(0), good.md5.Load())
+
+	// the hosts that failed cool down
+	if err := g.Download(t.Context(), "foo", dir); err != nil {
+		t.Fatal("failed to download", err)
+	}
+	assert.Equal(t, int32(1), primary.pbf.Load())
+	assert.Equal(t, int32(1), bad.pbf.Load())
+	assert.Equal(t, int32(2), good.pbf.Load())
+}
+
+func TestMirrorCoolDownExpires(t *testing.T) {
+	data := patternData(minSegmentSize)
+	primary := setupMirror(t, data, data, http.StatusBadGateway)
+	good := setupMirror(t, data, data, 0)
+
+	g, err := New(primary.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g, err = g.WithMirrors(good.URL)
+	if err != nil {
+		t.Fatal("could not add mirrors", err)
+	}
+	g.WithCoolDown(0)
+
+	dir := t.TempDir()
+	for range 2 {
+		if err := g.Download(t.Context(), "foo", dir); err != nil {
+			t.Fatal("failed to download", err)
+		}
+	}
+	assert.Equal(t, int32(2), primary.pbf.Load())
+	assert.Equal(t, int32(2), good.pbf.Load())
+}
+
+func TestMirrorConnectionError(t *testing.T) {
+	data := patternData(minSegmentSize)
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+	good := setupMirror(t, data, data, 0)
+
+	g, err := New(gone.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g, err = g.WithMirrors(good.URL)
+	if err != nil {
+		t.Fatal("could not add mirrors", err)
+	}
+
+	info, err := g.Stat(t.Context(), "foo", FileTypePBF)
+	if err != nil {
+		t.Fatal("failed to stat", err)
+	}
+	assert.Equal(t, good.URL+"/foo-latest.osm.pbf", info.URL)
+
+	// without the authoritative md5 a mirror is not trusted
+	requests := good.pbf.Load()
+	err = g.Download(t.Context(), "foo", t.TempDir())
+	var failed DownloadFailedError
+	if assert.ErrorAs(t, err, &failed) {
+		assert.Equal(t, 0, failed.Code)
+	}
+	assert.Equal(t, requests, good.pbf.Load())
+}
+
+func TestMirrorNotFoundIsNotRetried(t *testing.T) {
+	data := patternData(minSegmentSize)
+	primary := setupMirror(t, data, data, http.StatusNotFound)
+	good := setupMirror(t, data, data, 0)
+
+	g, err := New(primary.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g, err = g.WithMirrors(good.URL)
+	if err != nil {
+		t.Fatal("could not add mirrors", err)
+	}
+
+	err = g.Download(t.Context(), "foo", t.TempDir())
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, int32(0), good.pbf.Load())
+}
@@ -2,17 +2,124 @@ package geofabrik
 
 import (
 	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
+// segmentPattern is what every element of a dataset name has to look like.
+// It rules out traversal (..), separators, query strings and escapes.
+var segmentPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// datePattern is what the date of a dated extract has to look like, yymmdd.
+var datePattern = regexp.MustCompile(`^\d{6}$`)
+
+// Path describes where a file of a dataset is published and how it is
+// stored locally.
 type Path struct {
 	name     string
 	uri      string
+	url      string
 	filename string
+	ftype    FileType
+	// date of a dated extract as yymmdd, empty for the latest one.
+	date     string
+	provider Provider
+}
+
+// PathOptions configure ResolvePath.
+type PathOptions struct {
+	// Host the url is built with, defaults to the DefaultHost of Provider.
+	Host string
+	// Date of a dated extract as yymmdd, defaults to the latest extract.
+	Date string
+	// Provider the file is published by, defaults to DefaultProvider.
+	Provider Provider
+}
+
+// ResolvePath returns the Path of the file of type ftype of a dataset
+// without requesting anything. Like everywhere else name can be a plain name
+// like europe/germany/berlin or a url on the host.
+func ResolvePath(name string, ftype FileType, opts PathOptions) (*Path, error) {
+	provider := opts.Provider
+	if provider == nil {
+		provider = DefaultProvider
+	}
+	host := opts.Host
+	if host == "" {
+		host = provider.DefaultHost()
+	}
+	base, err := url.Parse(host)
+	if err != nil {
+		return &Path{}, fmt.Errorf("parsing host %q: %w", host, err)
+	}
+
+	ref := parseReference(provider, name, base)
+	if err := ref.checkHost(base); err != nil {
+		return &Path{}, err
+	}
+
+	date := opts.Date
+	if date == "" {
+		date = ref.date
+	}
+
+	p, err := providerPath(provider, ref.name, ftype, date)
+	if err != nil {
+		return &Path{}, err
+	}
+	p.url = strings.TrimSuffix(base.String(), "/") + p.uri
+
+	return p, nil
+}
+
+// Name returns the sanitized name of the dataset, e.g. europe/germany/berlin.
+func (p *Path) Name() string {
+	return p.name
+}
+
+// URI returns the path of the file on the host, e.g.
+// /europe/germany/berlin-latest.osm.pbf.
+func (p *Path) URI() string {
+	return p.uri
+}
+
+// URL returns the absolute url of the file. It is empty unless the Path was
+// created with ResolvePath or Geofabrik.URL.
+func (p *Path) URL() string {
+	return p.url
+}
+
+// Filename returns the name the file is stored as, e.g. berlin.osm.pbf.
+func (p *Path) Filename() string {
+	return p.filename
+}
+
+// FileType returns the type of the file.
+func (p *Path) FileType() FileType {
+	return p.ftype
+}
+
+// Date returns the date of a dated extract as yymmdd, empty for the latest.
+func (p *Path) Date() string {
+	return p.date
 }
 
 func newPath(name string, ftype FileType) (*Path, error) {
-	p := &Path{name: name}
+	return newDatedPath(name, ftype, "")
+}
+
+// newDatedPath returns the Path of the extract of date, formatted as yymmdd.
+func newDatedPath(name string, ftype FileType, date string) (*Path, error) {
+	return providerPath(DefaultProvider, name, ftype, date)
+}
+
+// providerPath returns the Path of a file as published by provider.
+func providerPath(provider Provider, name string, ftype FileType, date string) (*Path, error) {
+	p := &Path{name: name, ftype: ftype, date: date, provider: provider}
 
 	if err := p.process(ftype); err != nil {
 		return &Path{}, err
@@ -21,11 +128,72 @@ func newPath(name string, ftype FileType) (*Path, error) {
 	return p, nil
 }
 
+// Dataset returns the last element of the name, e.g. berlin for
+// europe/germany/berlin.
+func (p *Path) Dataset() string {
+	return path.Base(p.name)
+}
+
+// target returns where the file is stored in dir. It guarantees that the
+// result does not point outside of dir.
+func (p *Path) target(dir string) (string, error) {
+	if !filepath.IsLocal(p.filename) || filepath.Base(p.filename) != p.filename {
+		return "", InvalidNameError{Name: p.name, Reason: "filename escapes output path"}
+	}
+
+	return filepath.Join(dir, p.filename), nil
+}
+
+// checksum returns the Path of the checksum of a pbf.
+func (p *Path) checksum() (*Path, error) {
+	c, err := providerPath(p.provider, p.name, FileTypeMD5, p.date)
+	if err != nil {
+		return &Path{}, err
+	}
+	if p.url != "" {
+		c.url = strings.TrimSuffix(p.url, p.uri) + c.uri
+	}
+
+	return c, nil
+}
+
+// checksummed returns the filename on the host of the pbf whose checksum
+// is at p.
+func (p *Path) checksummed() (string, error) {
+	uri, err := p.provider.URI(p.name, FileTypePBF, p.date)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Base(uri), nil
+}
+
 func (p *Path) validate() error {
 	if p.name == "" {
 		return &EmptyNameError{}
 	}
 
+	name := strings.TrimPrefix(p.name, "/")
+	name = strings.TrimSuffix(name, "/")
+	for _, segment := range strings.Split(name, "/") {
+		if !segmentPattern.MatchString(segment) {
+			return InvalidNameError{
+				Name:   p.name,
+				Reason: fmt.Sprintf("invalid element %q", segment),
+			}
+		}
+	}
+
+	if p.date == "" {
+		return nil
+	}
+	if _, err := time.Parse(dateLayout, p.date); err != nil || !datePattern.MatchString(p.date) {
+		return InvalidNameError{
+			Name:   p.name,
+			Reason: fmt.Sprintf("invalid date %q, expected yymmdd", p.date),
+		}
+	}
+
 	return nil
 }
 
@@ -38,49 +206,103 @@ func (p *Path) process(ftype FileType) error {
 	p.name = strings.TrimPrefix(p.name, "/")
 	p.name = strings.TrimSuffix(p.name, "/")
 
-	elements := strings.Split(p.name, "/")
-	if len(elements) == 1 {
-		ds := elements[0]
-		switch ftype { //nolint: exhaustive
-		case polytype:
-			p.uri = fmt.Sprintf("/%s%s", ds, ftype)
-		default:
-			p.uri = fmt.Sprintf("/%s-latest%s", ds, ftype)
-		}
-		p.filename = fmt.Sprintf("%s%s", ds, ftype)
+	uri, err := p.provider.URI(p.name, ftype, p.date)
+	if err != nil {
+		return err
+	}
+	p.uri = uri
+	p.filename = p.localFilename(p.Dataset())
+
+	return nil
+}
+
+// localFilename is the name the file of dataset ds is stored as. Dated
+// extracts keep their date, see datedFilename.
+func (p *Path) localFilename(ds string) string {
+	if p.date == "" || p.ftype == FileTypePoly {
+		return fmt.Sprintf("%s%s", ds, p.ftype)
+	}
+
+	return fmt.Sprintf("%s-%s%s", ds, p.date, p.ftype)
+}
+
+// path resolves name and returns the Path of the file of type ftype on the
+// configured host.
+func (g *Geofabrik) path(name string, ftype FileType) (*Path, error) {
+	opts := PathOptions{Host: g.host.String(), Provider: g.Provider()}
+	if g.resolver == nil {
+		return ResolvePath(name, ftype, opts)
+	}
+
+	ref := parseReference(g.Provider(), name, g.host)
+	if err := ref.checkHost(g.host); err != nil {
+		return &Path{}, err
+	}
+
+	resolved, err := g.resolver.Resolve(ref.name)
+	if err != nil {
+		return &Path{}, err
+	}
+	opts.Date = ref.date
+
+	return ResolvePath(resolved, ftype, opts)
+}
+
+// inferType returns the FileType of the file name points to, or fallback if
+// name is not a file.
+func (g *Geofabrik) inferType(name string, fallback FileType) FileType {
+	if ref := parseReference(g.Provider(), name, nil); ref.ftype != "" {
+		return ref.ftype
+	}
+
+	return fallback
+}
+
+// reference is a dataset name given as url or path to a file.
+type reference struct {
+	name  string
+	host  string
+	ftype FileType
+	date  string
+}
+
+// checkHost returns a HostMismatchError if the reference is a url on
+// another host than base.
+func (r reference) checkHost(base *url.URL) error {
+	if r.host == "" || strings.EqualFold(r.host, base.Hostname()) {
 		return nil
 	}
 
-	ds := elements[len(elements)-1]
-	var f string
-	switch ftype { //nolint: exhaustive
-	case polytype:
-		f = fmt.Sprintf(
-			"%s%s",
-			ds,
-			ftype,
-		)
-	default:
-		f = fmt.Sprintf(
-			"%s-latest%s",
-			ds,
-			ftype,
-		)
-	}
-
-	p.uri = fmt.Sprintf(
-		"/%s/%s",
-		strings.Join(
-			elements[0:len(elements)-1], "/",
-		),
-		f,
-	)
-
-	p.filename = fmt.Sprintf(
-		"%s%s",
-		ds,
-		ftype,
-	)
+	return HostMismatchError{Host: r.host, Expected: base.Hostname()}
+}
+
+// parseReference accepts plain names like europe/germany/berlin as well as
+// full urls and paths to files like
+// https://download.geofabrik.de/europe/germany/berlin-latest.osm.pbf and
+// infers the FileType and date from the filename. base is the url of the
+// configured host, its path is stripped from the path of urls. The
+// filename is parsed by provider.
+func parseReference(provider Provider, name string, base *url.URL) reference {
+	ref := reference{name: name}
 
-	return nil
+	if u, err := url.Parse(name); err == nil && u.Scheme != "" && u.Host != "" {
+		ref.host = u.Hostname()
+		ref.name = u.Path
+		if base != nil {
+			prefix := strings.TrimSuffix(base.Path, "/")
+			ref.name = strings.TrimPrefix(ref.name, prefix)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			// let validation reject it
+			ref.name = name
+		}
+	}
+
+	name, ftype, date, ok := provider.Reference(ref.name)
+	if !ok {
+		return ref
+	}
+	ref.name, ref.ftype, ref.date = name, ftype, date
+
+	return ref
 }
@@ -1,6 +1,8 @@
 package geofabrik
 
 import (
+	"net/url"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,31 +19,31 @@ func TestTokenizePath(t *testing.T) {
 	tests := map[string]tcase{
 		"should tokenize one level": {
 			input:            "europe",
-			ftype:            pbftype,
+			ftype:            FileTypePBF,
 			expectedUri:      "/europe-latest.osm.pbf",
 			expectedFileName: "europe.osm.pbf",
 		},
 		"should tokenize two levels": {
 			input:            "europe/germany",
-			ftype:            pbftype,
+			ftype:            FileTypePBF,
 			expectedUri:      "/europe/germany-latest.osm.pbf",
 			expectedFileName: "germany.osm.pbf",
 		},
 		"should tokenize three levels": {
 			input:            "europe/germany/berlin",
-			ftype:            pbftype,
+			ftype:            FileTypePBF,
 			expectedUri:      "/europe/germany/berlin-latest.osm.pbf",
 			expectedFileName: "berlin.osm.pbf",
 		},
 		"should persist other seperators": {
 			input:            "europe/ireland-and-northern-ireland",
-			ftype:            pbftype,
+			ftype:            FileTypePBF,
 			expectedUri:      "/europe/ireland-and-northern-ireland-latest.osm.pbf",
 			expectedFileName: "ireland-and-northern-ireland.osm.pbf",
 		},
 		"should sanitize input": {
 			input:            "/europe/",
-			ftype:            pbftype,
+			ftype:            FileTypePBF,
 			expectedUri:      "/europe-latest.osm.pbf",
 			expectedFileName: "europe.osm.pbf",
 		},
@@ -56,3 +58,244 @@ func TestTokenizePath(t *testing.T) {
 		assert.Equal(t, test.expectedFileName, p.filename)
 	}
 }
+
+func TestInvalidPath(t *testing.T) {
+	tests := map[string]string{
+		"should reject traversal":        "../../etc/passwd",
+		"should reject inner traversal":  "europe/../germany",
+		"should reject current dir":      "europe/./germany",
+		"should reject backslash":        "europe\\germany",
+		"should reject query":            "europe/germany?foo=bar",
+		"should reject fragment":         "europe/germany#foo",
+		"should reject percent encoding": "europe/%2e%2e/germany",
+		"should reject whitespace":       "europe/ germany",
+		"should reject empty element":    "europe//germany",
+		"should reject only separator":   "/",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := newPath(input, FileTypePBF)
+
+			var got InvalidNameError
+			assert.ErrorAs(t, err, &got)
+			assert.Equal(t, input, got.Name)
+		})
+	}
+}
+
+func TestPathTarget(t *testing.T) {
+	p, err := newPath("europe/germany/berlin", FileTypePBF)
+	if err != nil {
+		t.Fatalf("failed to create valid path: %v", err.Error())
+	}
+
+	got, err := p.target("/data")
+	if err != nil {
+		t.Fatal("failed to build target", err)
+	}
+	assert.Equal(t, filepath.Join("/data", "berlin.osm.pbf"), got)
+
+	p.filename = "../berlin.osm.pbf"
+	_, err = p.target("/data")
+	assert.ErrorAs(t, err, &InvalidNameError{})
+}
+
+func TestParseReference(t *testing.T) {
+	base, err := url.Parse("https://download.geofabrik.de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror, err := url.Parse("https://mirror.example.com/geofabrik/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type tcase struct {
+		input    string
+		base     *url.URL
+		expected reference
+	}
+
+	tests := map[string]tcase{
+		"should keep plain name": {
+			input:    "europe/germany/berlin",
+			base:     base,
+			expected: reference{name: "europe/germany/berlin"},
+		},
+		"should parse url": {
+			input: "https://download.geofabrik.de/europe/germany/berlin-latest.osm.pbf",
+			base:  base,
+			expected: reference{
+				name:  "/europe/germany/berlin",
+				host:  "download.geofabrik.de",
+				ftype: FileTypePBF,
+			},
+		},
+		"should parse dated url": {
+			input: "http://download.geofabrik.de/europe/germany/berlin-251019.osm.pbf",
+			base:  base,
+			expected: reference{
+				name:  "/europe/germany/berlin",
+				host:  "download.geofabrik.de",
+				ftype: FileTypePBF,
+				date:  "251019",
+			},
+		},
+		"should parse md5 url": {
+			input: "https://download.geofabrik.de/europe-latest.osm.pbf.md5",
+			base:  base,
+			expected: reference{
+				name:  "/europe",
+				host:  "download.geofabrik.de",
+				ftype: FileTypeMD5,
+			},
+		},
+		"should parse poly url": {
+			input: "https://download.geofabrik.de/europe/ireland-and-northern-ireland.poly",
+			base:  base,
+			expected: reference{
+				name:  "/europe/ireland-and-northern-ireland",
+				host:  "download.geofabrik.de",
+				ftype: FileTypePoly,
+			},
+		},
+		"should strip path of mirror": {
+			input: "https://mirror.example.com/geofabrik/europe/germany-latest.osm.pbf",
+			base:  mirror,
+			expected: reference{
+				name:  "/europe/germany",
+				host:  "mirror.example.com",
+				ftype: FileTypePBF,
+			},
+		},
+		"should parse relative path with suffix": {
+			input: "europe/germany/berlin-latest.osm.pbf",
+			base:  base,
+			expected: reference{
+				name:  "europe/germany/berlin",
+				ftype: FileTypePBF,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseReference(DefaultProvider, tc.input, tc.base))
+		})
+	}
+}
+
+func TestDatedPath(t *testing.T) {
+	p, err := newDatedPath("europe/germany/berlin", FileTypePBF, "251019")
+	if err != nil {
+		t.Fatalf("failed to create valid path: %v", err.Error())
+	}
+	assert.Equal(t, "/europe/germany/berlin-251019.osm.pbf", p.uri)
+	assert.Equal(t, "berlin-251019.osm.pbf", p.filename)
+	assert.Equal(t, "berlin", p.Dataset())
+}
+
+func TestResolvePath(t *testing.T) {
+	type tcase struct {
+		name     string
+		ftype    FileType
+		opts     PathOptions
+		uri      string
+		url      string
+		filename string
+		dataset  string
+	}
+
+	tests := map[string]tcase{
+		"should resolve with default host": {
+			name:     "europe/germany/berlin",
+			ftype:    FileTypePBF,
+			uri:      "/europe/germany/berlin-latest.osm.pbf",
+			url:      "http://download.geofabrik.de/europe/germany/berlin-latest.osm.pbf",
+			filename: "berlin.osm.pbf",
+			dataset:  "berlin",
+		},
+		"should resolve with host": {
+			name:     "europe/germany",
+			ftype:    FileTypePoly,
+			opts:     PathOptions{Host: "https://mirror.example.com/geofabrik/"},
+			uri:      "/europe/germany.poly",
+			url:      "https://mirror.example.com/geofabrik/europe/germany.poly",
+			filename: "germany.poly",
+			dataset:  "germany",
+		},
+		"should resolve dated extract": {
+			name:     "europe/germany/berlin",
+			ftype:    FileTypeMD5,
+			opts:     PathOptions{Date: "251019"},
+			uri:      "/europe/germany/berlin-251019.osm.pbf.md5",
+			url:      "http://download.geofabrik.de/europe/germany/berlin-251019.osm.pbf.md5",
+			filename: "berlin-251019.osm.pbf.md5",
+			dataset:  "berlin",
+		},
+		"should resolve url": {
+			name:     "https://download.geofabrik.de/europe/germany/berlin-latest.osm.pbf",
+			ftype:    FileTypeMD5,
+			uri:      "/europe/germany/berlin-latest.osm.pbf.md5",
+			url:      "http://download.geofabrik.de/europe/germany/berlin-latest.osm.pbf.md5",
+			filename: "berlin.osm.pbf.md5",
+			dataset:  "berlin",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := ResolvePath(tc.name, tc.ftype, tc.opts)
+			if err != nil {
+				t.Fatal("failed to resolve path", err)
+			}
+			assert.Equal(t, tc.uri, p.URI())
+			assert.Equal(t, tc.url, p.URL())
+			assert.Equal(t, tc.filename, p.Filename())
+			assert.Equal(t, tc.dataset, p.Dataset())
+			assert.Equal(t, tc.ftype, p.FileType())
+		})
+	}
+
+	_, err := ResolvePath("https://example.com/europe-latest.osm.pbf", FileTypePBF, PathOptions{})
+	assert.ErrorAs(t, err, &HostMismatchError{})
+}
+
+func TestResolvePathInvalidDate(t *testing.T) {
+	tests := map[string]string{
+		"traversal": "x/../../../secret?a=b",
+		"query":     "251019?a=b",
+		"too short": "2510",
+		"no date":   "251399",
+	}
+
+	for name, date := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ResolvePath("europe/germany/berlin", FileTypePBF, PathOptions{Date: date})
+			assert.ErrorAs(t, err, &InvalidNameError{})
+		})
+	}
+}
+
+func TestChecksumPath(t *testing.T) {
+	for _, date := range []string{"", "251019"} {
+		opts := PathOptions{Date: date}
+		pbf, err := ResolvePath("europe/germany/berlin", FileTypePBF, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		md5, err := ResolvePath("europe/germany/berlin", FileTypeMD5, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := pbf.checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, md5.URI(), got.URI())
+		assert.Equal(t, md5.URL(), got.URL())
+		assert.Equal(t, FileTypeMD5, got.FileType())
+	}
+}
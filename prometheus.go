@@ -0,0 +1,181 @@
+package geofabrik
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the histograms of a
+// PrometheusMetrics in seconds, from quick requests to hour long downloads.
+var DefaultBuckets = []float64{0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+// help describes the metrics of this package in the exposition.
+var help = map[string]string{
+	MetricRequests:           "Requests by host, method and status code.",
+	MetricRequestDuration:    "Seconds until the response headers arrived.",
+	MetricDownloads:          "Downloads by result.",
+	MetricDownloadDuration:   "Seconds a successful download took.",
+	MetricDownloadBytes:      "Bytes of successful downloads.",
+	MetricFailovers:          "Hosts that failed and were skipped.",
+	MetricChecksumMismatches: "Downloads that did not match their md5.",
+	MetricIndexCache:         "Lookups of the cached index by result.",
+}
+
+// PrometheusMetrics keeps the measurements of a client in memory and serves
+// them in the Prometheus text format.
+type PrometheusMetrics struct {
+	buckets    []float64
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheusMetrics returns an empty PrometheusMetrics with histograms
+// of buckets, DefaultBuckets if none are given.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+
+	return &PrometheusMetrics{
+		buckets:    b,
+		counters:   map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+	}
+}
+
+func (m *PrometheusMetrics) Add(name string, labels Labels, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.counters[name]
+	if !ok {
+		series = map[string]float64{}
+		m.counters[name] = series
+	}
+	series[formatLabels(labels)] += delta
+}
+
+func (m *PrometheusMetrics) Observe(name string, labels Labels, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.histograms[name]
+	if !ok {
+		series = map[string]*histogram{}
+		m.histograms[name] = series
+	}
+	key := formatLabels(labels)
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		series[key] = h
+	}
+
+	for i, le := range m.buckets {
+		if value <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.Write(w)
+}
+
+// Write writes all metrics in the Prometheus text format to w.
+func (m *PrometheusMetrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	for _, name := range sortedKeys(m.counters) {
+		header(&b, name, "counter")
+		series := m.counters[name]
+		for _, labels := range sortedKeys(series) {
+			fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatValue(series[labels]))
+		}
+	}
+
+	for _, name := range sortedKeys(m.histograms) {
+		header(&b, name, "histogram")
+		series := m.histograms[name]
+		for _, labels := range sortedKeys(series) {
+			h := series[labels]
+			for i, le := range m.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLe(labels, formatValue(le)), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLe(labels, "+Inf"), h.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, labels, formatValue(h.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, labels, h.count)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func header(b *strings.Builder, name, kind string) {
+	if h, ok := help[name]; ok {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, h)
+	}
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+// formatLabels returns labels as {k="v",...} sorted by key, empty if there
+// are none.
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		pairs = append(pairs, k+`="`+labelEscaper.Replace(labels[k])+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes label values as the text format expects.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// withLe adds the le label of a bucket to formatted labels.
+func withLe(labels, le string) string {
+	if labels == "" {
+		return `{le="` + le + `"}`
+	}
+
+	return strings.TrimSuffix(labels, "}") + `,le="` + le + `"}`
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,79 @@
+package geofabrik
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics(1, 0.5)
+	m.Add(MetricDownloads, Labels{"result": "ok"}, 1)
+	m.Add(MetricDownloads, Labels{"result": "ok"}, 2)
+	m.Add(MetricDownloads, Labels{"result": "failed"}, 1)
+	m.Add("custom_total", Labels{"path": `a"b\c`}, 1)
+	m.Observe(MetricDownloadDuration, nil, 0.2)
+	m.Observe(MetricDownloadDuration, nil, 0.7)
+	m.Observe(MetricDownloadDuration, nil, 3)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `# TYPE custom_total counter
+custom_total{path="a\"b\\c"} 1
+# HELP geofabrik_downloads_total Downloads by result.
+# TYPE geofabrik_downloads_total counter
+geofabrik_downloads_total{result="failed"} 1
+geofabrik_downloads_total{result="ok"} 3
+# HELP geofabrik_download_duration_seconds Seconds a successful download took.
+# TYPE geofabrik_download_duration_seconds histogram
+geofabrik_download_duration_seconds_bucket{le="0.5"} 1
+geofabrik_download_duration_seconds_bucket{le="1"} 2
+geofabrik_download_duration_seconds_bucket{le="+Inf"} 3
+geofabrik_download_duration_seconds_sum 3.9
+geofabrik_download_duration_seconds_count 3
+`
+	assert.Equal(t, expected, rec.Body.String())
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+}
+
+func TestMetricsDownload(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	primary := setupMirror(t, data, data, 503)
+	mirror := setupMirror(t, data, data, 0)
+
+	g, err := New(primary.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	if g, err = g.WithMirrors(mirror.URL); err != nil {
+		t.Fatal(err)
+	}
+	m := NewPrometheusMetrics()
+	g.WithMetrics(m)
+
+	if err := g.Download(context.Background(), "foo", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	err = g.Download(context.Background(), "nope", t.TempDir())
+	assert.Error(t, err)
+
+	var out strings.Builder
+	if err := m.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	host := strings.TrimPrefix(primary.URL, "http://")
+	for _, line := range []string{
+		`geofabrik_downloads_total{result="ok"} 1`,
+		`geofabrik_downloads_total{result="failed"} 1`,
+		`geofabrik_download_bytes_total 262144`,
+		`geofabrik_failovers_total{host="` + host + `"} 1`,
+		`geofabrik_requests_total{code="503",host="` + host + `",method="GET"} 1`,
+		`geofabrik_download_duration_seconds_count 1`,
+	} {
+		assert.Contains(t, out.String(), line+"\n")
+	}
+}
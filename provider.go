@@ -0,0 +1,224 @@
+package geofabrik
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Provider is a source of OSM extracts. It knows where the files of a
+// dataset are published, how its checksums are formatted and where its
+// index is, if it has one.
+type Provider interface {
+	// Name identifies the provider, e.g. geofabrik.
+	Name() string
+	// DefaultHost is the download server of the provider.
+	DefaultHost() string
+	// URI returns the path of the file of type ftype of the dataset name on
+	// the host. date is empty for the latest extract. The file of type
+	// FileTypeMD5 is the one holding the checksum of the pbf.
+	URI(name string, ftype FileType, date string) (string, error)
+	// Reference is the inverse of URI. It returns the dataset, the
+	// FileType and the date of the file at uri, ok is false if uri is not
+	// a file of the provider. The dataset may keep a leading slash.
+	Reference(uri string) (name string, ftype FileType, date string, ok bool)
+	// ParseChecksum returns the checksum of the pbf called filename on the
+	// host from the content of its checksum file.
+	ParseChecksum(content, filename string) (Checksum, error)
+	// IndexURI returns the path of the index of all datasets, empty if the
+	// provider has none.
+	IndexURI() string
+}
+
+// DefaultProvider is used unless the client is given another Provider.
+var DefaultProvider Provider = GeofabrikProvider{}
+
+// providers are the Providers that can be looked up by name.
+var providers = map[string]Provider{
+	GeofabrikProvider{}.Name(): GeofabrikProvider{},
+	BBBikeProvider{}.Name():    BBBikeProvider{},
+}
+
+// ProviderByName returns the Provider called name, e.g. bbbike.
+func ProviderByName(name string) (Provider, error) {
+	p, ok := providers[strings.ToLower(name)]
+	if !ok {
+		return nil, UnknownProviderError{Name: name, Known: ProviderNames()}
+	}
+
+	return p, nil
+}
+
+// ProviderNames returns the names of all known Providers.
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// WithProvider sets the Provider paths, checksums and the index are
+// resolved with. The host is not changed, create the client with the
+// DefaultHost of the Provider unless it is mirrored elsewhere.
+func (g *Geofabrik) WithProvider(p Provider) *Geofabrik {
+	g.provider = p
+	return g
+}
+
+// Provider returns the Provider of the client.
+func (g *Geofabrik) Provider() Provider {
+	if g.provider == nil {
+		return DefaultProvider
+	}
+
+	return g.provider
+}
+
+// GeofabrikProvider publishes extracts at download.geofabrik.de, e.g.
+// /europe/germany/berlin-latest.osm.pbf with an md5 in
+// /europe/germany/berlin-latest.osm.pbf.md5.
+type GeofabrikProvider struct{}
+
+// suffixPattern splits a filename as published by Geofabrik into the
+// dataset, the version and the FileType.
+var suffixPattern = regexp.MustCompile(
+	`^(.+?)(?:-(latest|\d{6}))?(\.osm\.pbf\.md5|\.osm\.pbf|\.poly)$`,
+)
+
+func (GeofabrikProvider) Name() string {
+	return "geofabrik"
+}
+
+func (GeofabrikProvider) DefaultHost() string {
+	return DefaultHost
+}
+
+func (GeofabrikProvider) URI(name string, ftype FileType, date string) (string, error) {
+	version := "latest"
+	if date != "" {
+		version = date
+	}
+
+	dir, ds := path.Split(name)
+	if ftype == FileTypePoly {
+		return fmt.Sprintf("/%s%s%s", dir, ds, ftype), nil
+	}
+
+	return fmt.Sprintf("/%s%s-%s%s", dir, ds, version, ftype), nil
+}
+
+func (GeofabrikProvider) Reference(uri string) (string, FileType, string, bool) {
+	dir, file := path.Split(uri)
+	m := suffixPattern.FindStringSubmatch(file)
+	if m == nil {
+		return "", "", "", false
+	}
+
+	date := m[2]
+	if date == "latest" {
+		date = ""
+	}
+
+	return dir + m[1], FileType(m[3]), date, true
+}
+
+// ParseChecksum expects a single line of md5sum output naming filename.
+func (GeofabrikProvider) ParseChecksum(content, filename string) (Checksum, error) {
+	c, err := ParseChecksum(content)
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	if c.Filename != filename {
+		return Checksum{}, InvalidChecksumError{
+			Content: c.String(),
+			Reason:  "expected checksum of " + filename,
+		}
+	}
+
+	return c, nil
+}
+
+func (GeofabrikProvider) IndexURI() string {
+	return "/index-v1-nogeom.json"
+}
+
+// BBBikeProvider publishes extracts of about 200 cities at
+// download.bbbike.org, e.g. /osm/bbbike/Berlin/Berlin.osm.pbf. The md5 of
+// all files of a city are listed in /osm/bbbike/Berlin/CHECKSUM.txt. There
+// are neither dated extracts nor an index.
+type BBBikeProvider struct{}
+
+// bbbikeRoot is the directory all cities are published in.
+const bbbikeRoot = "/osm/bbbike/"
+
+func (BBBikeProvider) Name() string {
+	return "bbbike"
+}
+
+func (BBBikeProvider) DefaultHost() string {
+	return "https://download.bbbike.org"
+}
+
+func (b BBBikeProvider) URI(name string, ftype FileType, date string) (string, error) {
+	if strings.Contains(name, "/") {
+		return "", InvalidNameError{Name: name, Reason: "bbbike datasets are cities like Berlin"}
+	}
+	if date != "" {
+		return "", UnsupportedError{Provider: b.Name(), Feature: "dated extracts"}
+	}
+
+	if ftype == FileTypeMD5 {
+		return bbbikeRoot + name + "/CHECKSUM.txt", nil
+	}
+
+	return bbbikeRoot + name + "/" + name + string(ftype), nil
+}
+
+func (BBBikeProvider) Reference(uri string) (string, FileType, string, bool) {
+	rel, ok := strings.CutPrefix("/"+strings.TrimPrefix(uri, "/"), bbbikeRoot)
+	if !ok {
+		return "", "", "", false
+	}
+
+	city, file, ok := strings.Cut(rel, "/")
+	if !ok || city == "" {
+		return "", "", "", false
+	}
+
+	switch file {
+	case "CHECKSUM.txt":
+		return city, FileTypeMD5, "", true
+	case city + string(FileTypePBF):
+		return city, FileTypePBF, "", true
+	case city + string(FileTypePoly):
+		return city, FileTypePoly, "", true
+	}
+
+	return "", "", "", false
+}
+
+// ParseChecksum picks the line naming filename from the md5sum output of
+// all files of a city. Other lines, like sha256 sums, are ignored.
+func (BBBikeProvider) ParseChecksum(content, filename string) (Checksum, error) {
+	for _, line := range strings.Split(content, "\n") {
+		c, err := ParseChecksum(line)
+		if err == nil && c.Filename == filename {
+			return c, nil
+		}
+	}
+
+	return Checksum{}, InvalidChecksumError{
+		Content: snippet(strings.NewReader(content)),
+		Reason:  "no checksum of " + filename,
+	}
+}
+
+func (BBBikeProvider) IndexURI() string {
+	return ""
+}
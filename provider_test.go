@@ -0,0 +1,165 @@
+package geofabrik
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderURI(t *testing.T) {
+	type tcase struct {
+		provider Provider
+		name     string
+		ftype    FileType
+		date     string
+		expected string
+	}
+
+	tests := map[string]tcase{
+		"geofabrik pbf": {
+			provider: GeofabrikProvider{},
+			name:     "europe/germany/berlin",
+			ftype:    FileTypePBF,
+			expected: "/europe/germany/berlin-latest.osm.pbf",
+		},
+		"geofabrik dated md5": {
+			provider: GeofabrikProvider{},
+			name:     "europe",
+			ftype:    FileTypeMD5,
+			date:     "251019",
+			expected: "/europe-251019.osm.pbf.md5",
+		},
+		"geofabrik poly": {
+			provider: GeofabrikProvider{},
+			name:     "europe/germany",
+			ftype:    FileTypePoly,
+			expected: "/europe/germany.poly",
+		},
+		"bbbike pbf": {
+			provider: BBBikeProvider{},
+			name:     "Berlin",
+			ftype:    FileTypePBF,
+			expected: "/osm/bbbike/Berlin/Berlin.osm.pbf",
+		},
+		"bbbike checksum": {
+			provider: BBBikeProvider{},
+			name:     "Berlin",
+			ftype:    FileTypeMD5,
+			expected: "/osm/bbbike/Berlin/CHECKSUM.txt",
+		},
+		"bbbike poly": {
+			provider: BBBikeProvider{},
+			name:     "Berlin",
+			ftype:    FileTypePoly,
+			expected: "/osm/bbbike/Berlin/Berlin.poly",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			uri, err := tc.provider.URI(tc.name, tc.ftype, tc.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expected, uri)
+
+			ds, ftype, date, ok := tc.provider.Reference(uri)
+			assert.True(t, ok)
+			assert.Equal(t, tc.name, strings.TrimPrefix(ds, "/"))
+			assert.Equal(t, tc.ftype, ftype)
+			assert.Equal(t, tc.date, date)
+		})
+	}
+}
+
+func TestBBBikeUnsupported(t *testing.T) {
+	_, err := BBBikeProvider{}.URI("Berlin", FileTypePBF, "251019")
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	_, err = BBBikeProvider{}.URI("germany/Berlin", FileTypePBF, "")
+	assert.ErrorAs(t, err, &InvalidNameError{})
+
+	_, _, _, ok := BBBikeProvider{}.Reference("/osm/bbbike/Berlin/Berlin.osm.gz")
+	assert.False(t, ok)
+}
+
+func TestBBBikeChecksum(t *testing.T) {
+	content := fmt.Sprintf(
+		"%s  Berlin.osm.gz\n%s  Berlin.osm.pbf\n%s  Berlin.osm.pbf\n",
+		md5Hex([]byte("gz")),
+		fooMD5,
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	)
+
+	c, err := BBBikeProvider{}.ParseChecksum(content, "Berlin.osm.pbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Checksum{Hash: fooMD5, Filename: "Berlin.osm.pbf"}, c)
+
+	_, err = BBBikeProvider{}.ParseChecksum(content, "Hamburg.osm.pbf")
+	assert.ErrorAs(t, err, &InvalidChecksumError{})
+}
+
+func TestProviderByName(t *testing.T) {
+	p, err := ProviderByName("BBBike")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, BBBikeProvider{}, p)
+
+	_, err = ProviderByName("nope")
+	assert.ErrorAs(t, err, &UnknownProviderError{})
+	assert.Equal(t, []string{"bbbike", "geofabrik"}, ProviderNames())
+}
+
+func TestBBBikeDownload(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/osm/bbbike/Berlin/Berlin.osm.pbf":
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		case "/osm/bbbike/Berlin/CHECKSUM.txt":
+			fmt.Fprintf(w, "%s  Berlin.osm.pbf\n", md5Hex(data))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithProvider(BBBikeProvider{}).WithSegments(2)
+
+	ctx := context.Background()
+	c, err := g.Checksum(ctx, "Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, md5Hex(data), c.Hash)
+
+	dir := t.TempDir()
+	if err := g.Download(ctx, ts.URL+"/osm/bbbike/Berlin/Berlin.osm.pbf", dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "Berlin.osm.pbf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, data, got)
+
+	_, err = g.Index(ctx)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
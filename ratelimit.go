@@ -0,0 +1,126 @@
+package geofabrik
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxChunk is the most a rate limited read consumes at once, so the
+// transfer is smooth rather than bursty.
+const maxChunk = 32 << 10
+
+// RateLimiter is a token bucket limiting the bytes per second read from
+// download bodies. A single RateLimiter can be shared by concurrent
+// downloads, they split the bandwidth between them. The limit can be changed
+// while downloads are running.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter is the constructor for a RateLimiter allowing
+// bytesPerSecond. A limit <= 0 means unlimited.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimit(bytesPerSecond)
+	return l
+}
+
+// SetLimit changes the limit to bytesPerSecond, <= 0 means unlimited.
+func (l *RateLimiter) SetLimit(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = max(bytesPerSecond, 0)
+	l.tokens = float64(l.burst())
+	l.last = time.Now()
+}
+
+// Limit returns the current limit in bytes per second, 0 means unlimited.
+func (l *RateLimiter) Limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit
+}
+
+// burst is the size of the bucket, a second worth of tokens but at least
+// one chunk. l.mu must be held.
+func (l *RateLimiter) burst() int64 {
+	return max(l.limit, maxChunk)
+}
+
+// WaitN blocks until n bytes may be transferred or ctx is done.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.limit == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.limit)
+	l.tokens = min(l.tokens, float64(l.burst()))
+	l.last = now
+
+	// tokens may go negative, later callers queue up behind this one
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / float64(l.limit) * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// WithRateLimiter limits the bandwidth of all downloads of g.
+func (g *Geofabrik) WithRateLimiter(l *RateLimiter) *Geofabrik {
+	g.limiter = l
+	return g
+}
+
+// limit wraps r with the rate limiter of g, if any.
+func (g *Geofabrik) limit(ctx context.Context, r io.Reader) io.Reader {
+	if g.limiter == nil {
+		return r
+	}
+
+	return &limitedReader{ctx: ctx, r: r, l: g.limiter}
+}
+
+type limitedReader struct {
+	ctx context.Context //nolint: containedctx
+	r   io.Reader
+	l   *RateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxChunk {
+		p = p[:maxChunk]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,86 @@
+package geofabrik
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	type tcase struct {
+		limit int64
+		bytes int
+		min   time.Duration
+	}
+
+	tests := map[string]tcase{
+		"unlimited": {
+			limit: 0,
+			bytes: 10 << 20,
+		},
+		"within burst": {
+			limit: 1 << 20,
+			bytes: 1 << 20,
+		},
+		"beyond burst": {
+			limit: 1 << 20,
+			bytes: 3 << 19,
+			min:   400 * time.Millisecond,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			l := NewRateLimiter(tc.limit)
+			ctx := t.Context()
+
+			start := time.Now()
+			for sent := 0; sent < tc.bytes; sent += maxChunk {
+				if err := l.WaitN(ctx, maxChunk); err != nil {
+					t.Fatal(err)
+				}
+			}
+			elapsed := time.Since(start)
+
+			assert.GreaterOrEqual(t, elapsed, tc.min)
+			assert.Less(t, elapsed, tc.min+time.Second)
+		})
+	}
+}
+
+func TestRateLimiterSetLimit(t *testing.T) {
+	l := NewRateLimiter(-1)
+	assert.Equal(t, int64(0), l.Limit())
+
+	l.SetLimit(1 << 10)
+	assert.Equal(t, int64(1<<10), l.Limit())
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	// the bucket holds a single chunk, the second one takes half a minute
+	assert.NoError(t, l.WaitN(ctx, maxChunk))
+	assert.ErrorIs(t, l.WaitN(ctx, maxChunk), context.DeadlineExceeded)
+}
+
+func TestDownloadRateLimited(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithRateLimiter(NewRateLimiter(64 << 10))
+
+	start := time.Now()
+	result, err := g.DownloadWithResult(t.Context(), "foo", t.TempDir())
+	if err != nil {
+		t.Fatal("failed to download", err)
+	}
+
+	assert.Equal(t, int64(1028*128), result.Bytes)
+	// a second worth of bytes is in the bucket, the rest takes another second
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package geofabrik
+
+import (
+	"strings"
+)
+
+// maxSuggestions is the number of suggestions in an UnknownRegionError.
+const maxSuggestions = 3
+
+// Resolver maps the name of a region to its canonical path using the Index.
+// Besides the path, e.g. europe/germany/berlin, it accepts the id (berlin),
+// ISO 3166 codes (DE-BE) and any case variation of those.
+type Resolver struct {
+	index  *Index
+	byPath map[string]string
+	byID   map[string]string
+	byCode map[string]string
+}
+
+// NewResolver is the constructor for a Resolver.
+func NewResolver(index *Index) *Resolver {
+	r := &Resolver{
+		index:  index,
+		byPath: map[string]string{},
+		byID:   map[string]string{},
+		byCode: map[string]string{},
+	}
+
+	for _, region := range index.Regions {
+		path := region.Path()
+		if path == "" {
+			continue
+		}
+
+		r.byPath[strings.ToLower(path)] = path
+		r.byID[strings.ToLower(region.ID)] = path
+
+		for _, code := range region.ISO3166Subdivision {
+			r.byCode[strings.ToLower(code)] = path
+		}
+		// a country code can be shared by several regions, e.g. GB by
+		// great-britain and ireland-and-northern-ireland. Only the region
+		// that covers nothing but that country is addressed by it.
+		if len(region.ISO3166Alpha2) == 1 {
+			r.byCode[strings.ToLower(region.ISO3166Alpha2[0])] = path
+		}
+	}
+
+	return r
+}
+
+// Resolve returns the canonical path of name. If there is no such region
+// it returns an UnknownRegionError suggesting similar ones.
+func (r *Resolver) Resolve(name string) (string, error) {
+	key := strings.ToLower(strings.Trim(strings.TrimSpace(name), "/"))
+	if key == "" {
+		return "", EmptyNameError{}
+	}
+
+	for _, m := range []map[string]string{r.byPath, r.byID, r.byCode} {
+		if path, ok := m[key]; ok {
+			return path, nil
+		}
+	}
+
+	suggestions := []string{}
+	for _, region := range r.index.Search(key) {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+		if path := region.Path(); path != "" {
+			suggestions = append(suggestions, path)
+		}
+	}
+
+	return "", UnknownRegionError{Name: name, Suggestions: suggestions}
+}
+
+// WithResolver validates and normalizes every name passed to g against
+// the Resolver before issuing a request.
+func (g *Geofabrik) WithResolver(r *Resolver) *Geofabrik {
+	g.resolver = r
+	return g
+}
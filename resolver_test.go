@@ -0,0 +1,92 @@
+package geofabrik
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	r := NewResolver(loadTestIndex(t))
+
+	type tcase struct {
+		input       string
+		expected    string
+		suggestions []string
+	}
+
+	tests := map[string]tcase{
+		"should resolve path": {
+			input:    "europe/germany/berlin",
+			expected: "europe/germany/berlin",
+		},
+		"should resolve path case insensitive": {
+			input:    "/Europe/Germany/",
+			expected: "europe/germany",
+		},
+		"should resolve id": {
+			input:    "berlin",
+			expected: "europe/germany/berlin",
+		},
+		"should resolve subdivision code": {
+			input:    "DE-BE",
+			expected: "europe/germany/berlin",
+		},
+		"should resolve country code": {
+			input:    "de",
+			expected: "europe/germany",
+		},
+		"should not resolve shared country code": {
+			input:       "IE",
+			suggestions: []string{"europe/ireland-and-northern-ireland"},
+		},
+		"should suggest on typo": {
+			input:       "europe/germny",
+			suggestions: []string{"europe/germany"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := r.Resolve(tc.input)
+			if tc.suggestions == nil {
+				if err != nil {
+					t.Fatal("failed to resolve", err)
+				}
+				assert.Equal(t, tc.expected, got)
+				return
+			}
+
+			var unknown UnknownRegionError
+			assert.ErrorAs(t, err, &unknown)
+			assert.Equal(t, tc.input, unknown.Name)
+			assert.Equal(t, tc.suggestions, unknown.Suggestions)
+		})
+	}
+}
+
+func TestWithResolver(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithResolver(NewResolver(&Index{Regions: []Region{
+		{ID: "foo", Name: "Foo", URLs: map[string]string{"pbf": ts.URL + "/foo-latest.osm.pbf"}},
+	}}))
+
+	ctx := t.Context()
+
+	got, err := g.MD5(ctx, "FOO")
+	if err != nil {
+		t.Fatal("failed to get md5", err)
+	}
+	assert.Equal(t, fooMD5, got)
+
+	_, err = g.MD5(ctx, "fo")
+	var unknown UnknownRegionError
+	assert.ErrorAs(t, err, &unknown)
+	assert.Equal(t, []string{"foo"}, unknown.Suggestions)
+}
@@ -0,0 +1,208 @@
+package geofabrik
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// dateLayout is the date format Geofabrik uses in the filenames of dated
+// extracts, e.g. berlin-251019.osm.pbf.
+const dateLayout = "060102"
+
+var datedPattern = regexp.MustCompile(`^(.+)-(\d{6})(\.osm\.pbf)$`)
+
+// RetentionPolicy decides which dated copies of a dataset are kept. A copy
+// is kept if any of the rules selects it. A zero policy keeps everything.
+type RetentionPolicy struct {
+	// KeepLast keeps the newest n copies.
+	KeepLast int
+	// KeepDaily keeps the newest copy of each of the last n days.
+	KeepDaily int
+	// KeepMonthly keeps the newest copy of each of the last n months.
+	KeepMonthly int
+}
+
+// IsZero reports whether the policy has no rules.
+func (r RetentionPolicy) IsZero() bool {
+	return r.KeepLast == 0 && r.KeepDaily == 0 && r.KeepMonthly == 0
+}
+
+// PruneOptions configure Prune.
+type PruneOptions struct {
+	// DryRun only reports what would be removed.
+	DryRun bool
+}
+
+// datedCopy is a dated download of a dataset.
+type datedCopy struct {
+	path    string
+	dataset string
+	date    time.Time
+}
+
+// datedFilename returns the filename a copy of p downloaded at t is stored as.
+func datedFilename(p *Path, t time.Time) string {
+	return fmt.Sprintf("%s-%s%s", p.Dataset(), t.UTC().Format(dateLayout), p.ftype)
+}
+
+// parseDated parses a filename written by datedFilename.
+func parseDated(filename string) (dataset string, date time.Time, ok bool) {
+	m := datedPattern.FindStringSubmatch(filename)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+
+	date, err := time.Parse(dateLayout, m[2])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	return m[1], date, true
+}
+
+// datedCopies returns the dated copies in dir that were written by this
+// package, grouped by dataset and sorted newest first.
+func datedCopies(dir string) (map[string][]datedCopy, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string][]datedCopy{}, nil
+	}
+	if err != nil {
+		return map[string][]datedCopy{}, fmt.Errorf("reading directory %q: %w", dir, err)
+	}
+
+	copies := map[string][]datedCopy{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		dataset, date, ok := parseDated(e.Name())
+		if !ok {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		if !ownedByUs(path) {
+			continue
+		}
+
+		copies[dataset] = append(copies[dataset], datedCopy{
+			path:    path,
+			dataset: dataset,
+			date:    date,
+		})
+	}
+
+	for _, c := range copies {
+		sort.Slice(c, func(i, j int) bool {
+			return c[i].date.After(c[j].date)
+		})
+	}
+
+	return copies, nil
+}
+
+// marker is the suffix of the file every download leaves next to the file
+// it wrote. Unlike a checksum sidecar, which Geofabrik publishes as well, it
+// tells the files of this package apart from ones fetched with curl.
+const marker = ".geofabrik"
+
+// markOwned leaves the marker of the file at path, in md5sum format.
+func markOwned(path, sum string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+	if err := os.WriteFile(path+marker, []byte(line), 0o640); err != nil { //nolint: gosec
+		return fmt.Errorf("marking %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// ownedByUs reports whether the file at path was written by this package,
+// which leaves a marker naming the file next to it.
+func ownedByUs(path string) bool {
+	filename, err := sidecarFilename(path + marker)
+	if err != nil {
+		return false
+	}
+
+	return filename == filepath.Base(path)
+}
+
+// expired returns the copies not selected by the policy. copies must be
+// sorted newest first.
+func (r RetentionPolicy) expired(copies []datedCopy, now time.Time) []datedCopy {
+	if r.IsZero() {
+		return []datedCopy{}
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	days := map[string]bool{}
+	months := map[string]bool{}
+
+	out := []datedCopy{}
+	for i, c := range copies {
+		keep := i < r.KeepLast
+
+		day := c.date.Format("2006-01-02")
+		if !days[day] && today.Sub(c.date) < time.Duration(r.KeepDaily)*24*time.Hour {
+			days[day] = true
+			keep = true
+		}
+
+		month := c.date.Format("2006-01")
+		if !months[month] && monthsBetween(c.date, today) < r.KeepMonthly {
+			months[month] = true
+			keep = true
+		}
+
+		if !keep {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// monthsBetween returns the number of calendar months from to, e.g. 1 from
+// the 30th of september to the 1st of october.
+func monthsBetween(from, to time.Time) int {
+	return to.Year()*12 + int(to.Month()) - (from.Year()*12 + int(from.Month()))
+}
+
+// Prune removes the dated copies in dir that the policy does not keep,
+// along with their checksum sidecar and marker. Files not written by this
+// package are never touched. It returns the removed files.
+func Prune(dir string, policy RetentionPolicy, opts PruneOptions) ([]string, error) {
+	copies, err := datedCopies(dir)
+	if err != nil {
+		return []string{}, err
+	}
+
+	datasets := make([]string, 0, len(copies))
+	for dataset := range copies {
+		datasets = append(datasets, dataset)
+	}
+	sort.Strings(datasets)
+
+	removed := []string{}
+	for _, dataset := range datasets {
+		for _, c := range policy.expired(copies[dataset], time.Now()) {
+			removed = append(removed, c.path)
+			if opts.DryRun {
+				continue
+			}
+
+			for _, f := range []string{c.path, c.path + sidecar, c.path + marker} {
+				if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+					return removed, fmt.Errorf("removing %q: %w", f, err)
+				}
+			}
+		}
+	}
+
+	return removed, nil
+}
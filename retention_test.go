@@ -0,0 +1,231 @@
+package geofabrik
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeDatedCopy(t *testing.T, dir, filename string, owned bool) {
+	t.Helper()
+	path := filepath.Join(dir, filename)
+	if err := os.WriteFile(path, []byte("osm"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Geofabrik publishes the md5 of dated extracts as well
+	sum := fmt.Sprintf("%s  %s\n", fooMD5, filename)
+	if err := os.WriteFile(path+sidecar, []byte(sum), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !owned {
+		return
+	}
+	if err := markOwned(path, fooMD5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDated(t *testing.T) {
+	type tcase struct {
+		input   string
+		dataset string
+		date    time.Time
+		ok      bool
+	}
+
+	tests := map[string]tcase{
+		"should parse dated copy": {
+			input:   "berlin-251019.osm.pbf",
+			dataset: "berlin",
+			date:    time.Date(2025, 10, 19, 0, 0, 0, 0, time.UTC),
+			ok:      true,
+		},
+		"should parse dataset with separators": {
+			input:   "ireland-and-northern-ireland-250101.osm.pbf",
+			dataset: "ireland-and-northern-ireland",
+			date:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			ok:      true,
+		},
+		"should not parse latest": {
+			input: "berlin-latest.osm.pbf",
+		},
+		"should not parse undated": {
+			input: "berlin.osm.pbf",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dataset, date, ok := parseDated(tc.input)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.dataset, dataset)
+			assert.Equal(t, tc.date, date)
+		})
+	}
+}
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	day := func(offset int) datedCopy {
+		d := time.Date(2025, 10, 19, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -offset)
+		return datedCopy{path: d.Format(dateLayout), date: d}
+	}
+	// newest first, the 19th back to the 1st of august
+	copies := []datedCopy{}
+	for i := 0; i <= 79; i++ {
+		copies = append(copies, day(i))
+	}
+
+	type tcase struct {
+		policy RetentionPolicy
+		kept   int
+	}
+
+	tests := map[string]tcase{
+		"zero policy keeps everything": {
+			policy: RetentionPolicy{},
+			kept:   80,
+		},
+		"keep last": {
+			policy: RetentionPolicy{KeepLast: 3},
+			kept:   3,
+		},
+		"keep daily": {
+			policy: RetentionPolicy{KeepDaily: 7},
+			kept:   7,
+		},
+		"keep monthly": {
+			// newest of october, september and august
+			policy: RetentionPolicy{KeepMonthly: 3},
+			kept:   3,
+		},
+		"keep monthly counts calendar months": {
+			// the 30th of september is less than a month ago, but last month
+			policy: RetentionPolicy{KeepMonthly: 1},
+			kept:   1,
+		},
+		"keep monthly includes last month": {
+			// newest of october and september, not the 31st of august
+			policy: RetentionPolicy{KeepMonthly: 2},
+			kept:   2,
+		},
+		"combined": {
+			// the last 7 days plus the newest of september and august
+			policy: RetentionPolicy{KeepLast: 2, KeepDaily: 7, KeepMonthly: 3},
+			kept:   9,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			expired := tc.policy.expired(copies, now)
+			assert.Len(t, copies, tc.kept+len(expired))
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+
+	today := time.Now().UTC()
+	for i := range 5 {
+		d := today.AddDate(0, 0, -i)
+		writeDatedCopy(t, dir, fmt.Sprintf("foo-%s.osm.pbf", d.Format(dateLayout)), true)
+	}
+	foreign := fmt.Sprintf("foo-%s.osm.pbf", today.AddDate(0, 0, -10).Format(dateLayout))
+	writeDatedCopy(t, dir, foreign, false)
+
+	removed, err := Prune(dir, RetentionPolicy{KeepLast: 2}, PruneOptions{DryRun: true})
+	if err != nil {
+		t.Fatal("failed to prune", err)
+	}
+	assert.Len(t, removed, 3)
+	assert.True(t, fileExists(dir, filepath.Base(removed[0])))
+
+	removed, err = Prune(dir, RetentionPolicy{KeepLast: 2}, PruneOptions{})
+	if err != nil {
+		t.Fatal("failed to prune", err)
+	}
+	assert.Len(t, removed, 3)
+	for _, f := range removed {
+		assert.False(t, fileExists(dir, filepath.Base(f)))
+		assert.False(t, fileExists(dir, filepath.Base(f)+sidecar))
+		assert.False(t, fileExists(dir, filepath.Base(f)+marker))
+	}
+	assert.True(t, fileExists(dir, foreign))
+	assert.True(t, fileExists(dir, foreign+sidecar))
+}
+
+func TestPruneDatedDownloads(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("osm"))
+	}))
+	t.Cleanup(srv.Close)
+
+	g, err := New(srv.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	dir := t.TempDir()
+	files := []string{}
+	for _, offset := range []int{0, 10} {
+		date := time.Now().UTC().AddDate(0, 0, -offset).Format(dateLayout)
+		if err := g.Download(t.Context(), "foo-"+date+".osm.pbf", dir); err != nil {
+			t.Fatal("failed to download", err)
+		}
+		files = append(files, "foo-"+date+".osm.pbf")
+		assert.True(t, ownedByUs(filepath.Join(dir, files[len(files)-1])))
+	}
+
+	removed, err := Prune(dir, RetentionPolicy{KeepLast: 1}, PruneOptions{})
+	if err != nil {
+		t.Fatal("failed to prune", err)
+	}
+	assert.Equal(t, []string{filepath.Join(dir, files[1])}, removed)
+	assert.True(t, fileExists(dir, files[0]))
+	assert.False(t, fileExists(dir, files[1]+marker))
+}
+
+func TestSyncDated(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	dir := t.TempDir()
+	ctx := t.Context()
+
+	yesterday := fmt.Sprintf("foo-%s.osm.pbf", time.Now().UTC().AddDate(0, 0, -1).Format(dateLayout))
+	older := fmt.Sprintf("foo-%s.osm.pbf", time.Now().UTC().AddDate(0, 0, -2).Format(dateLayout))
+	writeDatedCopy(t, dir, older, true)
+	writeDatedCopy(t, dir, yesterday, true)
+	// yesterdays copy does not match the upstream md5
+	err = os.WriteFile(filepath.Join(dir, yesterday+sidecar), []byte("baz  "+yesterday+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifest{Regions: []ManifestEntry{{Name: "foo", Formats: []string{"pbf"}}}}
+	opts := SyncOptions{Dated: true, Retention: RetentionPolicy{KeepLast: 2}}
+
+	_, err = g.Sync(ctx, m, dir, opts)
+	if err != nil {
+		t.Fatal("failed to sync", err)
+	}
+
+	today := fmt.Sprintf("foo-%s.osm.pbf", time.Now().UTC().Format(dateLayout))
+	assert.True(t, fileExists(dir, today))
+	assert.True(t, fileExists(dir, today+sidecar))
+	assert.True(t, fileExists(dir, yesterday))
+	assert.False(t, fileExists(dir, older))
+}
@@ -0,0 +1,218 @@
+package geofabrik
+
+import (
+	"context"
+	"crypto/md5" //nolint: gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// minSegmentSize is the smallest byte range a download is split into.
+const minSegmentSize = 64 << 10
+
+// errRangesUnsupported makes a segmented download fall back to a single
+// stream.
+var errRangesUnsupported = errors.New("range requests are not supported")
+
+// WithSegments splits the download of a pbf into n byte ranges that are
+// fetched concurrently and verified against the md5 of the dataset
+// afterwards. If the server does not support range requests, the file is
+// downloaded with a single stream. n < 2 disables segmented downloads,
+// which is the default.
+func (g *Geofabrik) WithSegments(n int) *Geofabrik {
+	g.segments = n
+	return g
+}
+
+// segment is a byte range of a file, end is inclusive.
+type segment struct {
+	start int64
+	end   int64
+}
+
+func (s segment) size() int64 {
+	return s.end - s.start + 1
+}
+
+// split divides size bytes into at most n segments of at least
+// minSegmentSize. It returns no segments if a single stream is enough.
+func split(size int64, n int) []segment {
+	if maxN := size / minSegmentSize; int64(n) > maxN {
+		n = int(maxN)
+	}
+	if n < 2 {
+		return []segment{}
+	}
+
+	step := size / int64(n)
+	out := make([]segment, 0, n)
+	for i := range int64(n) {
+		s := segment{start: i * step, end: (i+1)*step - 1}
+		if i == int64(n)-1 {
+			s.end = size - 1
+		}
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// downloadSegmented downloads the pbf p points to from h in segments and
+// verifies it against want. It returns errRangesUnsupported if h does not
+// allow to.
+func (g *Geofabrik) downloadSegmented(ctx context.Context, h *upstream, p *Path, dest, want string) (DownloadResult, error) {
+	result := DownloadResult{
+		Name:    p.name,
+		Path:    dest,
+		Started: time.Now(),
+	}
+
+	info, err := g.statOn(ctx, h, p)
+	if err != nil {
+		return DownloadResult{}, err
+	}
+	parts := split(info.Size, g.segments)
+	if !info.AcceptRanges || len(parts) == 0 {
+		return DownloadResult{}, errRangesUnsupported
+	}
+
+	if err := g.checkSpace(filepath.Dir(dest), info.Size); err != nil {
+		return DownloadResult{}, err
+	}
+
+	err = g.writeAtOrRemove(ctx, dest, info.Size, func(f *os.File) error {
+		sctx, span := g.startSpan(ctx, SpanCopy)
+		span.SetAttribute("bytes", info.Size)
+		span.SetAttribute("segments", len(parts))
+		err := g.fetchSegments(sctx, h, p, info.ETag, parts, f)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+
+		md := md5.New() //nolint: gosec
+		if _, err := io.Copy(md, io.NewSectionReader(f, 0, info.Size)); err != nil {
+			return CopyFailedError{Message: err.Error(), Err: err}
+		}
+		result.MD5 = hex.EncodeToString(md.Sum(nil))
+
+		return g.verify(ctx, p, want, result.MD5)
+	})
+	if err != nil {
+		return DownloadResult{}, err
+	}
+
+	result.Bytes = info.Size
+	result.Duration = time.Since(result.Started)
+
+	return result, nil
+}
+
+// fetchSegments writes the segments of p on h to f concurrently. The first
+// failure cancels the remaining segments.
+func (g *Geofabrik) fetchSegments(ctx context.Context, h *upstream, p *Path, etag string, parts []segment, f *os.File) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	for _, s := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := g.fetchSegment(ctx, h, p, etag, s, f); err != nil {
+				once.Do(func() {
+					first = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	return first
+}
+
+func (g *Geofabrik) fetchSegment(ctx context.Context, h *upstream, p *Path, etag string, s segment, f *os.File) error {
+	header := map[string]string{
+		"Accept": accept(p.ftype),
+		"Range":  fmt.Sprintf("bytes=%d-%d", s.start, s.end),
+	}
+	// if the file changed in the meantime, the server sends all of it
+	if etag != "" {
+		header["If-Range"] = etag
+	}
+
+	res, err := g.do(ctx, h, "GET", p.uri, header)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusPartialContent {
+		return errRangesUnsupported
+	}
+
+	n, err := io.Copy(io.NewOffsetWriter(f, s.start), io.LimitReader(g.limit(ctx, res.Body), s.size()))
+	if err != nil {
+		return CopyFailedError{Message: err.Error(), Err: err}
+	}
+	if n != s.size() {
+		return CopyFailedError{
+			Message: fmt.Sprintf("segment %d-%d ended after %d bytes", s.start, s.end, n),
+		}
+	}
+
+	return nil
+}
+
+// writeAtOrRemove preallocates a temporary file of size bytes that write
+// fills in any order. It is moved to dest once write succeeds and removed
+// otherwise.
+func (g *Geofabrik) writeAtOrRemove(ctx context.Context, dest string, size int64, write func(f *os.File) error) (err error) {
+	tDir := tmpDir(filepath.Dir(dest))
+	f, created, err := createTemp(tDir)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			g.removeTemp(f, err)
+			if created {
+				_ = os.Remove(tDir)
+			}
+		}
+	}()
+
+	if err = f.Truncate(size); err != nil {
+		return fmt.Errorf("preallocating temporary file: %w", err)
+	}
+
+	if err = write(f); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("while syncing content to storage: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("while closing temporary file: %w", err)
+	}
+	err = g.rename(ctx, f.Name(), dest)
+
+	return err
+}
@@ -0,0 +1,206 @@
+package geofabrik
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupRangeServer serves data as foo-latest.osm.pbf with support for range
+// requests and sum as its md5. It counts the range requests.
+func setupRangeServer(t *testing.T, data []byte, sum string, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	ranged := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/foo-latest.osm.pbf":
+			if r.Header.Get("Range") != "" {
+				ranged.Add(1)
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		case "/foo-latest.osm.pbf.md5":
+			fmt.Fprintf(w, "%s  foo-latest.osm.pbf\n", sum)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, ranged
+}
+
+func patternData(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i*7 + i/251)
+	}
+	return b
+}
+
+func TestSplit(t *testing.T) {
+	type tcase struct {
+		size     int64
+		n        int
+		expected []segment
+	}
+
+	tests := map[string]tcase{
+		"disabled": {
+			size:     10 * minSegmentSize,
+			n:        1,
+			expected: []segment{},
+		},
+		"too small": {
+			size:     minSegmentSize + 1,
+			n:        4,
+			expected: []segment{},
+		},
+		"even": {
+			size: 4 * minSegmentSize,
+			n:    2,
+			expected: []segment{
+				{start: 0, end: 2*minSegmentSize - 1},
+				{start: 2 * minSegmentSize, end: 4*minSegmentSize - 1},
+			},
+		},
+		"remainder goes to the last segment": {
+			size: 3*minSegmentSize + 2,
+			n:    3,
+			expected: []segment{
+				{start: 0, end: minSegmentSize - 1},
+				{start: minSegmentSize, end: 2*minSegmentSize - 1},
+				{start: 2 * minSegmentSize, end: 3*minSegmentSize + 1},
+			},
+		},
+		"limited by minimum size": {
+			size: 2 * minSegmentSize,
+			n:    8,
+			expected: []segment{
+				{start: 0, end: minSegmentSize - 1},
+				{start: minSegmentSize, end: 2*minSegmentSize - 1},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, split(tc.size, tc.n))
+		})
+	}
+}
+
+func TestDownloadSegmented(t *testing.T) {
+	data := patternData(8*minSegmentSize + 123)
+	server, ranged := setupRangeServer(t, data, md5Hex(data), 0)
+
+	g, err := New(server.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithSegments(4)
+
+	dir := t.TempDir()
+	result, err := g.DownloadWithResult(t.Context(), "foo", dir)
+	if err != nil {
+		t.Fatal("failed to download", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "foo.osm.pbf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, bytes.Equal(data, got))
+	assert.Equal(t, md5Hex(data), result.MD5)
+	assert.Equal(t, int64(len(data)), result.Bytes)
+	assert.Equal(t, int32(4), ranged.Load())
+}
+
+func TestDownloadSegmentedFallback(t *testing.T) {
+	// the test server announces range support but ignores the Range header
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithSegments(4)
+
+	dir := t.TempDir()
+	result, err := g.DownloadWithResult(t.Context(), "foo", dir)
+	if err != nil {
+		t.Fatal("failed to download", err)
+	}
+	assert.Equal(t, int64(1028*128), result.Bytes)
+
+	// nothing but the file and its marker is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"foo.osm.pbf", "foo.osm.pbf" + marker}, names)
+}
+
+func TestDownloadSegmentedChecksumMismatch(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	server, _ := setupRangeServer(t, data, fooMD5, 0)
+
+	g, err := New(server.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithSegments(4)
+
+	dir := t.TempDir()
+	err = g.Download(t.Context(), "foo", dir)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, entries)
+}
+
+func TestDownloadSegmentedCancel(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	server, _ := setupRangeServer(t, data, md5Hex(data), time.Second)
+
+	g, err := New(server.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	g.WithSegments(4)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	dir := t.TempDir()
+	err = g.Download(ctx, "foo", dir)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,68 @@
+package geofabrik
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultSpaceMargin is the free space left on a filesystem after a download.
+const DefaultSpaceMargin = 100 << 20
+
+// WithSpaceMargin sets the free space in bytes that has to remain on the
+// filesystems of the temporary directory and the destination after a
+// download. A negative margin disables the check.
+func (g *Geofabrik) WithSpaceMargin(margin int64) *Geofabrik {
+	g.spaceMargin = margin
+	return g
+}
+
+// checkSpace fails with an InsufficientSpaceError unless size bytes and the
+// margin fit on the filesystems of dir and of its temporary directory. An
+// unknown size or platforms without support are not checked.
+func (g *Geofabrik) checkSpace(dir string, size int64) error {
+	if size <= 0 || g.spaceMargin < 0 {
+		return nil
+	}
+
+	dirs := []string{dir}
+	if tDir := tmpDir(dir); tDir != dir {
+		dirs = append(dirs, tDir)
+	}
+
+	for _, dir := range dirs {
+		available, err := freeSpace(existingDir(dir))
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("checking free space of %q: %w", dir, err)
+		}
+
+		if required := size + g.spaceMargin; available < required {
+			return InsufficientSpaceError{
+				Path:      dir,
+				Required:  required,
+				Available: available,
+			}
+		}
+	}
+
+	return nil
+}
+
+// existingDir returns dir or the closest of its parents that exists, as
+// the temporary directory is only created on the first download.
+func existingDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package geofabrik
+
+import "errors"
+
+// freeSpace is not implemented on this platform, downloads are not checked.
+func freeSpace(_ string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,85 @@
+package geofabrik
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func skipUnsupported(t *testing.T, dir string) {
+	t.Helper()
+	if _, err := freeSpace(dir); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("free space is not supported on this platform")
+	}
+}
+
+func TestExistingDir(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.Equal(t, dir, existingDir(dir))
+	assert.Equal(t, dir, existingDir(filepath.Join(dir, "a", "b")))
+}
+
+func TestDownloadInsufficientSpace(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	dir := t.TempDir()
+	skipUnsupported(t, dir)
+	ctx := t.Context()
+
+	g.WithSpaceMargin(1 << 60)
+	err = g.Download(ctx, "foo", dir)
+	var insufficient InsufficientSpaceError
+	if assert.ErrorAs(t, err, &insufficient) {
+		assert.Equal(t, dir, insufficient.Path)
+		assert.Equal(t, int64(1<<60+1028*128), insufficient.Required)
+	}
+	assert.False(t, fileExists(dir, "foo.osm.pbf"))
+
+	g.WithSpaceMargin(-1)
+	if err := g.Download(ctx, "foo", dir); err != nil {
+		t.Fatal("failed to download", err)
+	}
+	assert.True(t, fileExists(dir, "foo.osm.pbf"))
+}
+
+func TestSyncInsufficientSpace(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	dir := t.TempDir()
+	skipUnsupported(t, dir)
+	ctx := t.Context()
+
+	m := &Manifest{Regions: []ManifestEntry{{Name: "foo", Formats: []string{"pbf"}}}}
+
+	plan, err := g.Sync(ctx, m, dir, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatal("failed to plan", err)
+	}
+	assert.Equal(t, int64(1028*128), plan.Bytes)
+	assert.Equal(t, int64(1028*128), plan.Items[0].Bytes)
+
+	g.WithSpaceMargin(1 << 60)
+	plan, err = g.Sync(ctx, m, dir, SyncOptions{DryRun: true})
+	var insufficient InsufficientSpaceError
+	assert.ErrorAs(t, err, &insufficient)
+	assert.Equal(t, []SyncAction{SyncDownload}, actions(plan))
+
+	_, err = g.Sync(ctx, m, dir, SyncOptions{})
+	assert.ErrorAs(t, err, &insufficient)
+	assert.False(t, fileExists(dir, "foo.osm.pbf"))
+}
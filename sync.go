@@ -0,0 +1,477 @@
+package geofabrik
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5" //nolint: gosec
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sidecar is the suffix of the checksum file written next to a download.
+const sidecar = ".md5"
+
+// formats maps the format names used in a Manifest to their FileType.
+var formats = map[string]FileType{
+	"pbf":  FileTypePBF,
+	"poly": FileTypePoly,
+}
+
+// ManifestEntry is a single region of a Manifest.
+type ManifestEntry struct {
+	Name    string   `yaml:"name"`
+	Formats []string `yaml:"formats"`
+}
+
+// Manifest lists the regions and formats a directory should contain.
+type Manifest struct {
+	Regions []ManifestEntry `yaml:"regions"`
+}
+
+// LoadManifest reads a Manifest from a yaml file.
+func LoadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path) //nolint: gosec
+	if err != nil {
+		return &Manifest{}, fmt.Errorf("reading manifest %q: %w", path, err)
+	}
+
+	return ParseManifest(b)
+}
+
+// ParseManifest parses a yaml encoded Manifest.
+func ParseManifest(b []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := yaml.Unmarshal(b, m); err != nil {
+		return &Manifest{}, fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	for i, r := range m.Regions {
+		if r.Name == "" {
+			return &Manifest{}, EmptyNameError{}
+		}
+		if len(r.Formats) == 0 {
+			m.Regions[i].Formats = []string{"pbf"}
+		}
+		for _, f := range m.Regions[i].Formats {
+			if _, ok := formats[f]; !ok {
+				return &Manifest{}, UnknownFormatError{Format: f}
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// SyncAction is what Sync does with a single file.
+type SyncAction string
+
+const (
+	SyncKeep     SyncAction = "keep"
+	SyncDownload SyncAction = "download"
+	SyncRemove   SyncAction = "remove"
+)
+
+// SyncItem is a single step of a SyncPlan.
+type SyncItem struct {
+	Action SyncAction `json:"action"`
+	Name   string     `json:"name,omitempty"`
+	Path   string     `json:"path"`
+	Reason string     `json:"reason"`
+	MD5    string     `json:"md5,omitempty"`
+	// Bytes is the size of a download, if the server tells.
+	Bytes int64 `json:"bytes,omitempty"`
+	ftype FileType
+}
+
+// SyncPlan lists the steps required to bring a directory in line with
+// a Manifest.
+type SyncPlan struct {
+	Items []SyncItem `json:"items"`
+	// Bytes is the total size of the downloads.
+	Bytes int64 `json:"bytes"`
+}
+
+// SyncOptions configure Sync.
+type SyncOptions struct {
+	// DryRun only plans, nothing is downloaded or removed.
+	DryRun bool
+	// Dated stores every download of a pbf as a dated copy, e.g.
+	// berlin-251019.osm.pbf, instead of replacing the previous one.
+	Dated bool
+	// Retention is applied to the dated copies after syncing.
+	Retention RetentionPolicy
+}
+
+// Plan compares the contents of dir with the Manifest and the latest
+// upstream MD5 of every listed dataset.
+func (g *Geofabrik) Plan(ctx context.Context, m *Manifest, dir string, opts SyncOptions) (*SyncPlan, error) {
+	plan := &SyncPlan{}
+	wanted := map[string]bool{}
+
+	copies, err := datedCopies(dir)
+	if err != nil {
+		return &SyncPlan{}, err
+	}
+
+	for _, r := range m.Regions {
+		for _, f := range r.Formats {
+			ftype := formats[f]
+			p, err := g.resolve(ctx, r.Name, ftype)
+			if err != nil {
+				return &SyncPlan{}, err
+			}
+
+			file := p.filename
+			if wanted[file] {
+				return &SyncPlan{}, DuplicateFileError{Filename: file}
+			}
+			wanted[file] = true
+
+			var item SyncItem
+			if opts.Dated && ftype == FileTypePBF {
+				// older copies are left to the retention policy
+				for _, c := range copies[p.Dataset()] {
+					wanted[filepath.Base(c.path)] = true
+					wanted[filepath.Base(c.path)+sidecar] = true
+					wanted[filepath.Base(c.path)+marker] = true
+				}
+				item, err = g.planDated(ctx, p, dir, copies[p.Dataset()])
+			} else {
+				item, err = g.planItem(ctx, p, dir)
+			}
+			if err != nil {
+				return &SyncPlan{}, err
+			}
+
+			wanted[filepath.Base(item.Path)] = true
+			for _, suffix := range []string{sidecar, marker} {
+				wanted[file+suffix] = true
+				wanted[filepath.Base(item.Path)+suffix] = true
+			}
+
+			plan.Items = append(plan.Items, item)
+		}
+	}
+
+	if err := g.sizeDownloads(ctx, plan); err != nil {
+		return &SyncPlan{}, err
+	}
+
+	stale, err := staleFiles(dir, wanted)
+	if err != nil {
+		return &SyncPlan{}, err
+	}
+	for _, f := range stale {
+		plan.Items = append(plan.Items, SyncItem{
+			Action: SyncRemove,
+			Path:   f,
+			Reason: "not listed in manifest",
+		})
+	}
+
+	return plan, nil
+}
+
+// Sync downloads missing or changed datasets of the Manifest to dir and
+// removes the files it wrote that are no longer listed. Unless all downloads fit
+// into dir, it fails with an InsufficientSpaceError before changing
+// anything, in a dry run as well.
+func (g *Geofabrik) Sync(ctx context.Context, m *Manifest, dir string, opts SyncOptions) (*SyncPlan, error) {
+	plan, err := g.Plan(ctx, m, dir, opts)
+	if err != nil {
+		return plan, err
+	}
+
+	// replaced files are only removed once their successor is complete
+	if err := g.checkSpace(dir, plan.Bytes); err != nil {
+		return plan, err
+	}
+
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	for _, item := range plan.Items {
+		if err := g.apply(ctx, item); err != nil {
+			return plan, err
+		}
+	}
+
+	if !opts.Dated || opts.Retention.IsZero() {
+		return plan, nil
+	}
+
+	removed, err := Prune(dir, opts.Retention, PruneOptions{})
+	for _, f := range removed {
+		plan.Items = append(plan.Items, SyncItem{
+			Action: SyncRemove,
+			Path:   f,
+			Reason: "expired",
+		})
+	}
+
+	return plan, err
+}
+
+// sizeDownloads looks up the size of every download of the plan.
+func (g *Geofabrik) sizeDownloads(ctx context.Context, plan *SyncPlan) error {
+	for i, item := range plan.Items {
+		if item.Action != SyncDownload {
+			continue
+		}
+
+		p, err := g.resolve(ctx, item.Name, item.ftype)
+		if err != nil {
+			return err
+		}
+		info, err := g.stat(ctx, p)
+		if err != nil {
+			return err
+		}
+		if info.Size > 0 {
+			plan.Items[i].Bytes = info.Size
+			plan.Bytes += info.Size
+		}
+	}
+
+	return nil
+}
+
+func (g *Geofabrik) planItem(ctx context.Context, p *Path, dir string) (SyncItem, error) {
+	ftype := p.ftype
+	name := p.name
+	path, err := p.target(dir)
+	if err != nil {
+		return SyncItem{}, err
+	}
+
+	item := SyncItem{
+		Name:  name,
+		Path:  path,
+		ftype: ftype,
+	}
+
+	if _, err := os.Stat(item.Path); os.IsNotExist(err) {
+		item.Action = SyncDownload
+		item.Reason = "missing"
+		return item, nil
+	}
+
+	// there is no upstream checksum for anything but the pbf
+	if ftype != FileTypePBF {
+		item.Action = SyncKeep
+		item.Reason = "exists"
+		return item, nil
+	}
+
+	latest, err := g.MD5(ctx, name)
+	if err != nil {
+		return SyncItem{}, err
+	}
+	item.MD5 = latest
+
+	local, err := localMD5(item.Path)
+	if err != nil {
+		return SyncItem{}, err
+	}
+
+	if local == latest {
+		item.Action = SyncKeep
+		item.Reason = "up to date"
+		return item, nil
+	}
+
+	item.Action = SyncDownload
+	item.Reason = "changed"
+	return item, nil
+}
+
+// planDated plans a pbf kept as dated copies. copies are the existing
+// copies of the dataset, newest first.
+func (g *Geofabrik) planDated(ctx context.Context, p *Path, dir string, copies []datedCopy) (SyncItem, error) {
+	item := SyncItem{
+		Name:  p.name,
+		Path:  filepath.Join(dir, datedFilename(p, time.Now())),
+		ftype: p.ftype,
+	}
+
+	if len(copies) == 0 {
+		item.Action = SyncDownload
+		item.Reason = "missing"
+		return item, nil
+	}
+
+	latest, err := g.MD5(ctx, p.name)
+	if err != nil {
+		return SyncItem{}, err
+	}
+	item.MD5 = latest
+
+	local, err := localMD5(copies[0].path)
+	if err != nil {
+		return SyncItem{}, err
+	}
+
+	if local == latest {
+		item.Action = SyncKeep
+		item.Path = copies[0].path
+		item.Reason = "up to date"
+		return item, nil
+	}
+
+	item.Action = SyncDownload
+	item.Reason = "changed"
+	return item, nil
+}
+
+func (g *Geofabrik) apply(ctx context.Context, item SyncItem) error {
+	switch item.Action {
+	case SyncDownload:
+		p, err := g.resolve(ctx, item.Name, item.ftype)
+		if err != nil {
+			return err
+		}
+		result, err := g.download(ctx, p, item.Path)
+		if err != nil {
+			return err
+		}
+		if item.ftype != FileTypePBF {
+			return nil
+		}
+		return g.writeSidecar(ctx, item.Path, result.MD5)
+	case SyncRemove:
+		if err := os.Remove(item.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %q: %w", item.Path, err)
+		}
+		return nil
+	case SyncKeep:
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (g *Geofabrik) writeSidecar(ctx context.Context, path, sum string) error {
+	return g.writeOrRemove(ctx, path+sidecar, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%s  %s\n", sum, filepath.Base(path))
+		return err
+	})
+}
+
+// localMD5 returns the md5 of the file at path, preferring the sidecar
+// written by Sync over hashing the file itself.
+func localMD5(path string) (string, error) {
+	if sum, err := readSidecar(path + sidecar); err == nil {
+		return sum, nil
+	}
+
+	f, err := os.Open(path) //nolint: gosec
+	if err != nil {
+		return "", fmt.Errorf("opening %q: %w", path, err)
+	}
+	defer f.Close()
+
+	h := md5.New() //nolint: gosec
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %q: %w", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readSidecar(path string) (string, error) {
+	sum, _, err := parseSidecar(path)
+	return sum, err
+}
+
+func sidecarFilename(path string) (string, error) {
+	_, filename, err := parseSidecar(path)
+	return filename, err
+}
+
+// parseSidecar reads a checksum file in md5sum format.
+func parseSidecar(path string) (sum, filename string, err error) {
+	f, err := os.Open(path) //nolint: gosec
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		return "", "", fmt.Errorf("empty checksum file %q", path)
+	}
+
+	fields := strings.Fields(s.Text())
+	switch len(fields) {
+	case 0:
+		return "", "", fmt.Errorf("empty checksum file %q", path)
+	case 1:
+		return fields[0], "", nil
+	default:
+		return fields[0], fields[1], nil
+	}
+}
+
+// staleFiles returns the dataset files in dir that are not wanted. Only
+// files written by this package along with their sidecar and marker are
+// considered, others may share dir.
+func staleFiles(dir string, wanted map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return []string{}, fmt.Errorf("reading directory %q: %w", dir, err)
+	}
+
+	stale := []string{}
+	for _, e := range entries {
+		if e.IsDir() || wanted[e.Name()] || !managed(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+
+		// a marker left behind by a file removed by hand
+		if file, ok := strings.CutSuffix(path, marker); ok {
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				stale = append(stale, path)
+			}
+			continue
+		}
+		if strings.HasSuffix(path, sidecar) || !ownedByUs(path) {
+			continue
+		}
+
+		stale = append(stale, path)
+		for _, f := range []string{path + sidecar, path + marker} {
+			if _, err := os.Stat(f); err == nil && !wanted[filepath.Base(f)] {
+				stale = append(stale, f)
+			}
+		}
+	}
+	sort.Strings(stale)
+
+	return stale, nil
+}
+
+// managed reports whether filename looks like a file Sync writes.
+func managed(filename string) bool {
+	for _, suffix := range []FileType{FileTypePBF, FileTypePoly} {
+		for _, extra := range []string{"", sidecar, marker} {
+			if strings.HasSuffix(filename, string(suffix)+extra) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
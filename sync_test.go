@@ -0,0 +1,165 @@
+package geofabrik
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseManifest(t *testing.T) {
+	type tcase struct {
+		input    string
+		expected *Manifest
+		err      bool
+	}
+
+	tests := map[string]tcase{
+		"should default to pbf": {
+			input: "regions:\n  - name: europe/germany/berlin\n",
+			expected: &Manifest{Regions: []ManifestEntry{
+				{Name: "europe/germany/berlin", Formats: []string{"pbf"}},
+			}},
+		},
+		"should parse formats": {
+			input: "regions:\n  - name: europe\n    formats: [pbf, poly]\n",
+			expected: &Manifest{Regions: []ManifestEntry{
+				{Name: "europe", Formats: []string{"pbf", "poly"}},
+			}},
+		},
+		"should fail on unknown format": {
+			input: "regions:\n  - name: europe\n    formats: [shp]\n",
+			err:   true,
+		},
+		"should fail on empty name": {
+			input: "regions:\n  - formats: [pbf]\n",
+			err:   true,
+		},
+	}
+
+	fn := func(tc tcase) func(*testing.T) {
+		return func(t *testing.T) {
+			t.Helper()
+			got, err := ParseManifest([]byte(tc.input))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to parse manifest", err)
+			}
+
+			assert.Equal(t, tc.expected, got)
+		}
+	}
+
+	for name, tc := range tests {
+		t.Run(name, fn(tc))
+	}
+}
+
+func TestSync(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	dir := t.TempDir()
+	ctx := t.Context()
+
+	// written by an earlier sync, it has a sidecar and a marker
+	stale := filepath.Join(dir, "old.osm.pbf")
+	if err := os.WriteFile(stale, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale+sidecar, []byte(md5Hex([]byte("old"))+"  old.osm.pbf\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := markOwned(stale, md5Hex([]byte("old"))); err != nil {
+		t.Fatal(err)
+	}
+	// fetched with curl along with the md5 Geofabrik publishes
+	foreign := filepath.Join(dir, "hamburg-latest.osm.pbf")
+	if err := os.WriteFile(foreign, []byte("not ours"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	published := md5Hex([]byte("not ours")) + "  hamburg-latest.osm.pbf\n"
+	if err := os.WriteFile(foreign+sidecar, []byte(published), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	unmanaged := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(unmanaged, []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifest{Regions: []ManifestEntry{
+		{Name: "foo", Formats: []string{"pbf", "poly"}},
+	}}
+
+	plan, err := g.Sync(ctx, m, dir, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatal("failed to plan", err)
+	}
+	assert.Equal(t, []SyncAction{SyncDownload, SyncDownload, SyncRemove, SyncRemove, SyncRemove}, actions(plan))
+	assert.True(t, fileExists(dir, "old.osm.pbf"))
+	assert.False(t, fileExists(dir, "foo.osm.pbf"))
+
+	_, err = g.Sync(ctx, m, dir, SyncOptions{})
+	if err != nil {
+		t.Fatal("failed to sync", err)
+	}
+	assert.True(t, fileExists(dir, "foo.osm.pbf"))
+	assert.True(t, fileExists(dir, "foo.osm.pbf.md5"))
+	assert.True(t, fileExists(dir, "foo.poly"))
+	assert.True(t, fileExists(dir, "foo.poly"+marker))
+	assert.True(t, fileExists(dir, "notes.txt"))
+	assert.True(t, fileExists(dir, "hamburg-latest.osm.pbf"))
+	assert.True(t, fileExists(dir, "hamburg-latest.osm.pbf.md5"))
+	assert.False(t, fileExists(dir, "old.osm.pbf"))
+	assert.False(t, fileExists(dir, "old.osm.pbf.md5"))
+	assert.False(t, fileExists(dir, "old.osm.pbf"+marker))
+
+	err = os.WriteFile(filepath.Join(dir, "foo.osm.pbf.md5"), []byte(fooMD5+"  foo.osm.pbf\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err = g.Plan(ctx, m, dir, SyncOptions{})
+	if err != nil {
+		t.Fatal("failed to plan", err)
+	}
+	assert.Equal(t, []SyncAction{SyncKeep, SyncKeep}, actions(plan))
+}
+
+func TestPlanDuplicateFile(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	m := &Manifest{Regions: []ManifestEntry{
+		{Name: "asia/georgia", Formats: []string{"pbf"}},
+		{Name: "north-america/us/georgia", Formats: []string{"pbf"}},
+	}}
+
+	_, err = g.Plan(t.Context(), m, t.TempDir(), SyncOptions{})
+
+	var got DuplicateFileError
+	assert.ErrorAs(t, err, &got)
+	assert.Equal(t, "georgia.osm.pbf", got.Filename)
+}
+
+func actions(plan *SyncPlan) []SyncAction {
+	out := []SyncAction{}
+	for _, item := range plan.Items {
+		out = append(out, item.Action)
+	}
+	return out
+}
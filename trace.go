@@ -0,0 +1,97 @@
+package geofabrik
+
+import (
+	"context"
+	"os"
+)
+
+// Tracer starts spans around the steps of a download: path resolution,
+// requests, copying the body, checksum verification and the final rename.
+// An adapter can forward them to OpenTelemetry or any other tracing system.
+type Tracer interface {
+	// Start starts a span called name as child of the span in ctx, if any.
+	// The returned context carries the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a step of an operation started by a Tracer.
+type Span interface {
+	// SetAttribute sets key, e.g. region, file_type, http.status_code or
+	// bytes.
+	SetAttribute(key string, value any)
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	// End finishes the span.
+	End()
+}
+
+// Names of the spans a Geofabrik starts.
+const (
+	SpanDownload = "geofabrik.download"
+	SpanResolve  = "geofabrik.resolve"
+	SpanRequest  = "geofabrik.request"
+	SpanCopy     = "geofabrik.copy"
+	SpanVerify   = "geofabrik.verify"
+	SpanRename   = "geofabrik.rename"
+)
+
+// NopTracer starts spans that record nothing, it is the default.
+type NopTracer struct{}
+
+func (NopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, any) {}
+
+func (nopSpan) RecordError(error) {}
+
+func (nopSpan) End() {}
+
+// WithTracer sets the Tracer the client starts its spans with.
+func (g *Geofabrik) WithTracer(t Tracer) *Geofabrik {
+	g.tracer = t
+	return g
+}
+
+// startSpan starts a span with the configured Tracer.
+func (g *Geofabrik) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if g.tracer == nil {
+		return NopTracer{}.Start(ctx, name)
+	}
+
+	return g.tracer.Start(ctx, name)
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// resolve is path in a span.
+func (g *Geofabrik) resolve(ctx context.Context, name string, ftype FileType) (*Path, error) {
+	_, span := g.startSpan(ctx, SpanResolve)
+	span.SetAttribute("region", name)
+	span.SetAttribute("file_type", string(ftype))
+
+	p, err := g.path(name, ftype)
+	endSpan(span, err)
+
+	return p, err
+}
+
+// rename moves the finished temporary file to dest in a span.
+func (g *Geofabrik) rename(ctx context.Context, tmp, dest string) error {
+	_, span := g.startSpan(ctx, SpanRename)
+	span.SetAttribute("path", dest)
+
+	err := os.Rename(tmp, dest)
+	endSpan(span, err)
+
+	return err
+}
@@ -0,0 +1,185 @@
+package geofabrik
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedSpan is a span kept by a spanRecorder.
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]any
+	err    error
+	ended  bool
+	mu     *sync.Mutex
+}
+
+func (s *recordedSpan) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *recordedSpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+}
+
+type spanKey struct{}
+
+// spanRecorder is an in-memory Tracer.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &recordedSpan{name: name, attrs: map[string]any{}, mu: &r.mu}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = parent.name
+	}
+
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// named returns the recorded spans called name.
+func (r *spanRecorder) named(name string) []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := []*recordedSpan{}
+	for _, s := range r.spans {
+		if s.name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestTraceDownload(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	m := setupMirror(t, data, data, 0)
+
+	g, err := New(m.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	rec := &spanRecorder{}
+	g.WithTracer(rec).WithSegments(2)
+
+	if err := g.Download(context.Background(), "foo", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range rec.spans {
+		assert.True(t, s.ended, s.name)
+		assert.NoError(t, s.err, s.name)
+	}
+
+	resolve := rec.named(SpanResolve)
+	if assert.Len(t, resolve, 1) {
+		assert.Equal(t, "foo", resolve[0].attrs["region"])
+		assert.Equal(t, string(FileTypePBF), resolve[0].attrs["file_type"])
+	}
+
+	download := rec.named(SpanDownload)
+	if assert.Len(t, download, 1) {
+		assert.Equal(t, int64(len(data)), download[0].attrs["bytes"])
+	}
+
+	// md5, HEAD and two segments
+	requests := rec.named(SpanRequest)
+	assert.Len(t, requests, 4)
+	for _, s := range requests {
+		assert.Contains(t, []string{SpanDownload, SpanCopy}, s.parent)
+		assert.Contains(t, []any{http.StatusOK, http.StatusPartialContent}, s.attrs["http.status_code"])
+	}
+
+	for _, name := range []string{SpanCopy, SpanVerify, SpanRename} {
+		spans := rec.named(name)
+		if assert.Len(t, spans, 1, name) {
+			assert.Equal(t, SpanDownload, spans[0].parent, name)
+		}
+	}
+}
+
+func TestTraceFailedRequest(t *testing.T) {
+	m := setupMirror(t, nil, nil, http.StatusNotFound)
+
+	g, err := New(m.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	rec := &spanRecorder{}
+	g.WithTracer(rec)
+
+	err = g.Download(context.Background(), "foo", t.TempDir())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	requests := rec.named(SpanRequest)
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, http.StatusNotFound, requests[0].attrs["http.status_code"])
+		assert.Error(t, requests[0].err)
+	}
+	download := rec.named(SpanDownload)
+	if assert.Len(t, download, 1) {
+		assert.ErrorIs(t, download[0].err, ErrNotFound)
+	}
+	assert.Empty(t, rec.named(SpanRename))
+}
+
+// roundTripFunc is a http.RoundTripper calling itself.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTraceRequestContext(t *testing.T) {
+	data := patternData(minSegmentSize)
+	m := setupMirror(t, data, data, 0)
+
+	var mu sync.Mutex
+	spans := []string{}
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if s, ok := req.Context().Value(spanKey{}).(*recordedSpan); ok {
+			mu.Lock()
+			spans = append(spans, s.name)
+			mu.Unlock()
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	g, err := NewClient(m.URL, WithTransport(rt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.WithTracer(&spanRecorder{})
+
+	if err := g.Download(context.Background(), "foo", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotEmpty(t, spans)
+	for _, name := range spans {
+		assert.Equal(t, SpanRequest, name)
+	}
+}
@@ -0,0 +1,164 @@
+package geofabrik
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iwpnd/rip"
+)
+
+// doer sends requests, *http.Client implements it.
+type doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Option configures the http client of NewClient.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	client    *http.Client
+	transport http.RoundTripper
+	timeout   time.Duration
+	header    http.Header
+}
+
+// WithHTTPClient sends all requests with c, e.g. one with mTLS, a proxy or
+// instrumentation configured.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *clientOptions) {
+		o.client = c
+	}
+}
+
+// WithTransport sends all requests with rt, it replaces the Transport of the
+// http client.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *clientOptions) {
+		o.transport = rt
+	}
+}
+
+// WithTimeout limits every request including reading its body to d, it
+// replaces the Timeout of the http client.
+func WithTimeout(d time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = d
+	}
+}
+
+// WithHeader sends the header key with value on every request, e.g. a
+// User-Agent instead of DefaultUserAgent.
+func WithHeader(key, value string) Option {
+	return func(o *clientOptions) {
+		o.header.Set(key, value)
+	}
+}
+
+// NewClient returns a Geofabrik for host that sends its requests with a
+// standard http client. Unlike New it does not depend on rip, the embedded
+// rip.Client is nil.
+func NewClient(host string, options ...Option) (*Geofabrik, error) {
+	o := &clientOptions{header: http.Header{}}
+	for _, option := range options {
+		option(o)
+	}
+
+	c := &http.Client{}
+	if o.client != nil {
+		cp := *o.client
+		c = &cp
+	}
+	if o.transport != nil {
+		c.Transport = o.transport
+	}
+	if o.timeout != 0 {
+		c.Timeout = o.timeout
+	}
+
+	dial := func(rawURL string) (*upstream, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return &upstream{}, err
+		}
+		return &upstream{url: u, client: c}, nil
+	}
+
+	h, err := dial(host)
+	if err != nil {
+		return &Geofabrik{}, err
+	}
+
+	return newGeofabrik(h, nil, o.header, dial), nil
+}
+
+// ripDoer sends requests with a rip.Client, for clients created with New.
+type ripDoer struct {
+	client *rip.Client
+	// prefix is stripped from request urls, rip prepends its host again.
+	prefix string
+}
+
+func newRipUpstream(rawURL string, options ...rip.Option) (*upstream, error) {
+	c, err := rip.NewClient(rawURL, options...)
+	if err != nil {
+		return &upstream{}, err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return &upstream{}, err
+	}
+
+	h := &upstream{url: u}
+	h.client = ripDoer{client: c, prefix: h.urlOf("")}
+
+	return h, nil
+}
+
+func (d ripDoer) Do(req *http.Request) (*http.Response, error) {
+	r := d.client.NR()
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+
+	res, err := r.Execute(req.Context(), req.Method, strings.TrimPrefix(req.URL.String(), d.prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        res.Status(),
+		StatusCode:    res.StatusCode(),
+		Header:        res.Header(),
+		Body:          ripBody{res},
+		ContentLength: res.ContentLength(),
+		Request:       req,
+	}, nil
+}
+
+// ripBody reads the body of a rip.Response and closes it.
+type ripBody struct {
+	res *rip.Response
+}
+
+func (b ripBody) Read(p []byte) (int, error) {
+	return b.res.RawBody().Read(p)
+}
+
+func (b ripBody) Close() error {
+	return b.res.Close()
+}
+
+// releaseBody calls release once the body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
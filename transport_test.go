@@ -0,0 +1,111 @@
+package geofabrik
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iwpnd/rip"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingTransport counts requests and remembers the last User-Agent.
+type countingTransport struct {
+	n         atomic.Int32
+	userAgent atomic.Value
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.n.Add(1)
+	c.userAgent.Store(req.Header.Get("User-Agent"))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewClient(t *testing.T) {
+	data := patternData(4 * minSegmentSize)
+	primary := setupMirror(t, data, data, http.StatusServiceUnavailable)
+	mirror := setupMirror(t, data, data, 0)
+
+	rt := &countingTransport{}
+	g, err := NewClient(primary.URL, WithTransport(rt), WithHeader("User-Agent", "test/1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, g.Client)
+	if g, err = g.WithMirrors(mirror.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Download(context.Background(), "foo", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// md5 and pbf from the primary, pbf from the mirror
+	assert.Equal(t, int32(3), rt.n.Load())
+	assert.Equal(t, "test/1.0", rt.userAgent.Load())
+	assert.Equal(t, int32(1), mirror.pbf.Load())
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	data := patternData(minSegmentSize)
+	m := setupMirror(t, data, data, 0)
+
+	rt := &countingTransport{}
+	g, err := NewClient(
+		m.URL,
+		WithHTTPClient(&http.Client{Transport: http.DefaultTransport}),
+		WithTransport(rt),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md5, err := g.MD5(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, md5Hex(data), md5)
+	assert.Equal(t, DefaultUserAgent, rt.userAgent.Load())
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	g, err := NewClient(slow.URL, WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = g.MD5(context.Background(), "foo")
+	var failed DownloadFailedError
+	if assert.ErrorAs(t, err, &failed) {
+		assert.Equal(t, 0, failed.Code)
+	}
+}
+
+func TestNewRipOptions(t *testing.T) {
+	var userAgent atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent.Store(r.Header.Get("User-Agent"))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	g, err := New(srv.URL, rip.WithDefaultHeaders(rip.Header{"User-Agent": "rip/1.0"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, g.Client)
+
+	_, err = g.MD5(context.Background(), "foo")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, "rip/1.0", userAgent.Load())
+}
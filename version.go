@@ -0,0 +1,42 @@
+package geofabrik
+
+import "runtime/debug"
+
+// modulePath is the path the library is required by.
+const modulePath = "github.com/iwpnd/go-geofabrik"
+
+// Version of the library as recorded in the build info of the binary, e.g.
+// v0.3.1, or "devel" if it is not known.
+var Version = version()
+
+// DefaultUserAgent is sent unless the client is configured with another
+// User-Agent.
+var DefaultUserAgent = "go-geofabrik/" + Version + " (+https://github.com/iwpnd/go-geofabrik)"
+
+func version() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+
+	var m *debug.Module
+	if bi.Main.Path == modulePath {
+		m = &bi.Main
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			m = dep
+		}
+	}
+	if m == nil {
+		return "devel"
+	}
+	if m.Replace != nil {
+		m = m.Replace
+	}
+	if m.Version == "" || m.Version == "(devel)" {
+		return "devel"
+	}
+
+	return m.Version
+}
@@ -0,0 +1,178 @@
+package geofabrik
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State remembers the md5 of the last download of every watched dataset.
+type State struct {
+	MD5 map[string]string `json:"md5"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// LoadState reads the State persisted at path. A missing file results in an
+// empty State that is saved to path.
+func LoadState(path string) (*State, error) {
+	s := &State{MD5: map[string]string{}, path: path}
+
+	b, err := os.ReadFile(path) //nolint: gosec
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return &State{}, fmt.Errorf("reading state %q: %w", path, err)
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return &State{}, fmt.Errorf("parsing state %q: %w", path, err)
+	}
+	if s.MD5 == nil {
+		s.MD5 = map[string]string{}
+	}
+
+	return s, nil
+}
+
+// Get returns the last seen md5 of a dataset.
+func (s *State) Get(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.MD5[name]
+}
+
+// Set records the md5 of a dataset and persists the State.
+func (s *State) Set(name, md5 string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.MD5[name] = md5
+
+	return s.save()
+}
+
+func (s *State) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling state: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".state-")
+	if err != nil {
+		return fmt.Errorf("creating temporary state file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing state: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing state: %w", err)
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+// WatchOptions configure Watch.
+type WatchOptions struct {
+	// Interval between two checks, defaults to an hour.
+	Interval time.Duration
+	// Dir the datasets are downloaded to.
+	Dir string
+	// State to compare the upstream md5 with. Defaults to an in memory State.
+	State *State
+	// OnDownload is called after a changed dataset was downloaded.
+	OnDownload func(ctx context.Context, result DownloadResult) error
+	// OnError is called when checking or downloading a dataset fails.
+	// Watch keeps going either way.
+	OnError func(name string, err error)
+}
+
+// Watch periodically checks the upstream md5 of the datasets and downloads
+// the ones that changed since the last check. It blocks until ctx is done.
+func (g *Geofabrik) Watch(ctx context.Context, names []string, opts WatchOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+	if opts.State == nil {
+		opts.State = &State{MD5: map[string]string{}}
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(string, error) {}
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, name := range names {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := g.check(ctx, name, opts); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return nil
+				}
+				opts.OnError(name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *Geofabrik) check(ctx context.Context, name string, opts WatchOptions) error {
+	latest, err := g.MD5(ctx, name)
+	if err != nil {
+		return err
+	}
+	if latest == opts.State.Get(name) {
+		return nil
+	}
+
+	p, err := g.resolve(ctx, name, FileTypePBF)
+	if err != nil {
+		return err
+	}
+
+	dest, err := p.target(opts.Dir)
+	if err != nil {
+		return err
+	}
+
+	result, err := g.download(ctx, p, dest)
+	if err != nil {
+		return err
+	}
+	if err := g.writeSidecar(ctx, result.Path, result.MD5); err != nil {
+		return err
+	}
+	// the md5 of what was written, upstream may have changed meanwhile
+	if err := opts.State.Set(name, result.MD5); err != nil {
+		return err
+	}
+
+	if opts.OnDownload == nil {
+		return nil
+	}
+
+	return opts.OnDownload(ctx, result)
+}
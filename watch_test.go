@@ -0,0 +1,144 @@
+package geofabrik
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	teardown := setupTestServer(nil)
+	defer teardown()
+
+	g, err := New(ts.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+
+	state, err := LoadState(statePath)
+	if err != nil {
+		t.Fatal("failed to load state", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	results := []DownloadResult{}
+	errs := []error{}
+	err = g.Watch(ctx, []string{"foo", "missing"}, WatchOptions{
+		Interval: 10 * time.Millisecond,
+		Dir:      dir,
+		State:    state,
+		OnDownload: func(_ context.Context, result DownloadResult) error {
+			results = append(results, result)
+			return nil
+		},
+		OnError: func(_ string, err error) {
+			errs = append(errs, err)
+			// stop after the second round
+			if len(errs) == 2 {
+				cancel()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal("failed to watch", err)
+	}
+
+	// foo is only downloaded once, the md5 did not change in between
+	assert.Len(t, results, 1)
+	assert.Equal(t, "foo", results[0].Name)
+	assert.Equal(t, int64(1028*128), results[0].Bytes)
+	assert.True(t, fileExists(dir, "foo.osm.pbf"))
+	assert.True(t, fileExists(dir, "foo.osm.pbf.md5"))
+
+	// a restart picks up the persisted state
+	state, err = LoadState(statePath)
+	if err != nil {
+		t.Fatal("failed to load state", err)
+	}
+	assert.Equal(t, fooMD5, state.Get("foo"))
+}
+
+func TestWatchCheck(t *testing.T) {
+	old := patternData(minSegmentSize)
+	updated := patternData(minSegmentSize + 1)
+
+	var md5s, pbfs atomic.Int32
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/foo-latest.osm.pbf.md5":
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			// the extract is updated right after the first md5 was fetched
+			published := updated
+			if md5s.Add(1) == 1 {
+				published = old
+			}
+			fmt.Fprintf(w, "%s  foo-latest.osm.pbf\n", md5Hex(published))
+		case "/foo-latest.osm.pbf":
+			pbfs.Add(1)
+			_, _ = w.Write(updated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	g, err := New(srv.URL)
+	if err != nil {
+		t.Fatal("could not initialize client")
+	}
+	opts := WatchOptions{Dir: t.TempDir(), State: &State{MD5: map[string]string{}}}
+
+	if err := g.check(t.Context(), "foo", opts); err != nil {
+		t.Fatal("failed to check", err)
+	}
+	assert.Equal(t, md5Hex(updated), opts.State.Get("foo"))
+
+	// what is on disk is up to date already
+	if err := g.check(t.Context(), "foo", opts); err != nil {
+		t.Fatal("failed to check", err)
+	}
+	assert.Equal(t, int32(1), pbfs.Load())
+
+	// without an md5 the region is skipped
+	failing.Store(true)
+	assert.ErrorIs(t, g.check(t.Context(), "foo", opts), ErrServerError)
+	assert.Equal(t, int32(1), pbfs.Load())
+}
+
+func TestDownloadResultJSON(t *testing.T) {
+	result := DownloadResult{
+		Name:     "foo",
+		Started:  time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC),
+		Duration: 1500 * time.Millisecond,
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]any{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1.5, got["duration"])
+	assert.Equal(t, "foo", got["name"])
+	assert.Equal(t, "2025-10-19T12:00:00Z", got["started"])
+}